@@ -0,0 +1,234 @@
+package wsqlx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// ErrLockNotAcquired is returned by the try variants when the lock is held
+	// by another session.
+	ErrLockNotAcquired = errors.New("wsqlx: advisory lock is held by another session")
+	// ErrLockNotInTx is returned by LockTx and TryLockTx for an Rdbms that is
+	// not the transaction of DoTx.
+	ErrLockNotInTx = errors.New("wsqlx: transaction-scoped advisory lock outside a transaction")
+	// ErrLockReleased is returned by Release for a lock released already.
+	ErrLockReleased = errors.New("wsqlx: advisory lock is released already")
+
+	errLockUnsupported = errors.New("wsqlx: advisory locks are not supported for this dialect")
+)
+
+// LockID hashes key with FNV-1a to the 64-bit ID of the Postgres advisory lock.
+func LockID(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+// mysqlLockName returns the GET_LOCK name of key, which is limited to 64
+// characters.
+func mysqlLockName(key string) string {
+	if len(key) <= 64 {
+		return key
+	}
+	return fmt.Sprintf("wsqlx_%x", uint64(LockID(key)))
+}
+
+// AdvisoryLock is a session-scoped advisory lock. It pins the connection it was
+// acquired on until Release, so it has to be released even if the work failed.
+type AdvisoryLock struct {
+	s    *rdbms
+	key  string
+	conn *sqlx.Conn
+
+	mu       sync.Mutex
+	released bool
+}
+
+// Lock acquires the session-scoped advisory lock of key, waiting until it is
+// free or ctx is done.
+func (s *rdbms) Lock(ctx context.Context, key string) (*AdvisoryLock, error) {
+	return s.lockSession(ctx, key, false)
+}
+
+// TryLock acquires the session-scoped advisory lock of key, or returns
+// ErrLockNotAcquired right away when it is held.
+func (s *rdbms) TryLock(ctx context.Context, key string) (*AdvisoryLock, error) {
+	return s.lockSession(ctx, key, true)
+}
+
+func (s *rdbms) lockSession(ctx context.Context, key string, try bool) (lock *AdvisoryLock, err error) {
+	ctx, span := s.startLockSpan(ctx, "acquire advisory lock", key, "session")
+	defer span.End()
+	defer func() {
+		span.SetAttributes(DBLockAcquired.Bool(err == nil))
+		if !errors.Is(err, ErrLockNotAcquired) {
+			recordError(span, err)
+		}
+	}()
+
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return nil, errTracer(err)
+	}
+
+	if err = s.acquireLock(ctx, conn, key, try, false); err != nil {
+		return nil, errTracer(errors.Join(err, conn.Close()))
+	}
+
+	return &AdvisoryLock{s: s, key: key, conn: conn}, nil
+}
+
+// Release releases the lock and returns its connection to the pool. The lock
+// is released even if ctx is done already.
+func (l *AdvisoryLock) Release(ctx context.Context) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return ErrLockReleased
+	}
+	l.released = true
+
+	ctx, span := l.s.startLockSpan(context.WithoutCancel(ctx), "release advisory lock", l.key, "session")
+	defer span.End()
+
+	switch l.s.dialect {
+	case DialectPostgres:
+		_, err = l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", LockID(l.key))
+	case DialectMySQL:
+		_, err = l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", mysqlLockName(l.key))
+	}
+
+	err = errors.Join(err, l.conn.Close())
+	if err != nil {
+		recordError(span, err)
+		return errTracer(err)
+	}
+	return nil
+}
+
+// LockTx acquires the transaction-scoped advisory lock of key in tx, which has
+// to be the Rdbms passed to the callback of DoTx, or a decorator of it with an
+// Unwrap() Rdbms method. The lock is released when the transaction ends.
+func LockTx(ctx context.Context, tx Rdbms, key string) error {
+	return lockTx(ctx, tx, key, false)
+}
+
+// TryLockTx is LockTx returning ErrLockNotAcquired right away when the lock is
+// held.
+func TryLockTx(ctx context.Context, tx Rdbms, key string) error {
+	return lockTx(ctx, tx, key, true)
+}
+
+// rdbmsUnwrapper is implemented by decorators of an Rdbms, like the ones of
+// wsqlxfault and wsqlxtest, so LockTx finds the transaction they wrap.
+type rdbmsUnwrapper interface {
+	Unwrap() Rdbms
+}
+
+func lockTx(ctx context.Context, tx Rdbms, key string, try bool) (err error) {
+	s, ok := tx.(*rdbms)
+	for !ok {
+		unwrapper, isDecorator := tx.(rdbmsUnwrapper)
+		if !isDecorator {
+			break
+		}
+		tx = unwrapper.Unwrap()
+		s, ok = tx.(*rdbms)
+	}
+	if !ok || s.tx == nil {
+		return errTracer(ErrLockNotInTx)
+	}
+
+	ctx, span := s.startLockSpan(ctx, "acquire advisory lock", key, "transaction")
+	defer span.End()
+	defer func() {
+		span.SetAttributes(DBLockAcquired.Bool(err == nil))
+		if !errors.Is(err, ErrLockNotAcquired) {
+			recordError(span, err)
+		}
+	}()
+
+	if err = s.acquireLock(ctx, s.tx.tx, key, try, true); err != nil {
+		return errTracer(err)
+	}
+	if s.dialect == DialectMySQL {
+		s.tx.addLock(key)
+	}
+	return nil
+}
+
+// acquireLock runs the lock statement of the dialect on executor. MySQL has no
+// transaction-scoped lock, its locks are released by releaseTxLocks instead.
+func (s *rdbms) acquireLock(ctx context.Context, executor queryExecutor, key string, try, xact bool) error {
+	var acquired sql.NullBool
+	var err error
+
+	switch s.dialect {
+	case DialectPostgres:
+		fn := "pg_advisory_lock"
+		switch {
+		case try && xact:
+			fn = "pg_try_advisory_xact_lock"
+		case try:
+			fn = "pg_try_advisory_lock"
+		case xact:
+			fn = "pg_advisory_xact_lock"
+		}
+
+		if try {
+			err = executor.QueryRowxContext(ctx, "SELECT "+fn+"($1)", LockID(key)).Scan(&acquired)
+		} else {
+			_, err = executor.ExecContext(ctx, "SELECT "+fn+"($1)", LockID(key))
+			acquired.Bool = true
+		}
+	case DialectMySQL:
+		timeout := -1
+		if try {
+			timeout = 0
+		}
+		err = executor.QueryRowxContext(ctx, "SELECT GET_LOCK(?, ?)", mysqlLockName(key), timeout).Scan(&acquired)
+	default:
+		return errLockUnsupported
+	}
+
+	if err != nil {
+		return err
+	}
+	if !acquired.Bool {
+		return ErrLockNotAcquired
+	}
+	return nil
+}
+
+// releaseTxLocks releases the MySQL locks taken with LockTx on conn, the
+// connection the transaction was begun on, once it ended, and returns conn to
+// the pool. Releasing them earlier would let another session take a lock
+// before the writes it guards are committed.
+func (s *rdbms) releaseTxLocks(ctx context.Context, conn *sqlx.Conn, tx *rdbms) error {
+	var err error
+	for _, key := range tx.tx.takeLocks() {
+		_, errRelease := conn.ExecContext(context.WithoutCancel(ctx), "SELECT RELEASE_LOCK(?)", mysqlLockName(key))
+		err = errors.Join(err, errRelease)
+	}
+	return errors.Join(err, conn.Close())
+}
+
+func (s *rdbms) startLockSpan(ctx context.Context, name, key, scope string) (context.Context, trace.Span) {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(DBLockKey.String(key), DBLockScope.String(scope)),
+	}
+	if s.attrs != nil {
+		opts = append(opts, trace.WithAttributes(s.attrs...))
+	}
+
+	return s.tracer.Start(ctx, name, opts...)
+}
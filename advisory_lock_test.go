@@ -0,0 +1,138 @@
+package wsqlx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rdbms_AdvisoryLock(t *testing.T) {
+	ctx := context.TODO()
+	lockID := wsqlx.LockID("cron:daily-report")
+
+	t.Run("should hold a session lock on postgres until released", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithDialect(wsqlx.DialectPostgres))
+
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_lock($1)`)).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_unlock($1)`)).WithArgs(lockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		lock, err := sqlxx.Lock(ctx, "cron:daily-report")
+		require.NoError(t, err)
+		require.NoError(t, lock.Release(ctx))
+		require.ErrorIs(t, lock.Release(ctx), wsqlx.ErrLockReleased)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should fail fast when the lock is held", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithDialect(wsqlx.DialectPostgres))
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_lock($1)`)).WithArgs(lockID).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+
+		_, err = sqlxx.TryLock(ctx, "cron:daily-report")
+		require.ErrorIs(t, err, wsqlx.ErrLockNotAcquired)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should take a transaction-scoped lock on postgres", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithDialect(wsqlx.DialectPostgres))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT pg_try_advisory_xact_lock($1)`)).WithArgs(lockID).
+			WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_xact_lock"}).AddRow(true))
+		mock.ExpectCommit()
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			return wsqlx.TryLockTx(ctx, tx, "cron:daily-report")
+		})
+		require.NoError(t, err)
+		require.ErrorIs(t, wsqlx.LockTx(ctx, sqlxx, "cron:daily-report"), wsqlx.ErrLockNotInTx)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should release transaction-scoped locks on mysql after the commit", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithDialect(wsqlx.DialectMySQL))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT GET_LOCK(?, ?)`)).WithArgs("cron:daily-report", -1).
+			WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+		mock.ExpectCommit()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT RELEASE_LOCK(?)`)).WithArgs("cron:daily-report").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			return wsqlx.LockTx(ctx, tx, "cron:daily-report")
+		})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should release transaction-scoped locks on mysql after the rollback", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithDialect(wsqlx.DialectMySQL))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT GET_LOCK(?, ?)`)).WithArgs("cron:daily-report", -1).
+			WillReturnRows(sqlmock.NewRows([]string{"lock"}).AddRow(1))
+		mock.ExpectRollback()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT RELEASE_LOCK(?)`)).WithArgs("cron:daily-report").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		errJob := errors.New("job failed")
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			if err := wsqlx.LockTx(ctx, tx, "cron:daily-report"); err != nil {
+				return err
+			}
+			return errJob
+		})
+		require.ErrorIs(t, err, errJob)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should lock through a decorator of the transaction", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithDialect(wsqlx.DialectPostgres))
+
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SELECT pg_advisory_xact_lock($1)`)).WithArgs(lockID).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			return wsqlx.LockTx(ctx, decoratedRdbms{Rdbms: tx}, "cron:daily-report")
+		})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+type decoratedRdbms struct {
+	wsqlx.Rdbms
+}
+
+func (d decoratedRdbms) Unwrap() wsqlx.Rdbms {
+	return d.Rdbms
+}
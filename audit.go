@@ -0,0 +1,266 @@
+package wsqlx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// AuditRedacted replaces the args of audit entries when AuditConfig.Redact is nil.
+const AuditRedacted = "[REDACTED]"
+
+// AuditEntry describes one write. RowsAffected of a write with a RETURNING
+// clause run through QuerySq or QueryRowSq is the number of returned rows.
+type AuditEntry struct {
+	Time         time.Time `json:"time"`
+	Actor        string    `json:"actor"`
+	Operation    string    `json:"operation"`
+	Table        string    `json:"table"`
+	SQL          string    `json:"sql"`
+	Args         []any     `json:"args"`
+	RowsAffected int64     `json:"rows_affected"`
+}
+
+// AuditSink receives the audit entries. Transactional sinks receive them before
+// the transaction commits, with db bound to the transaction, so a failing sink
+// rolls the audited writes back. Other sinks receive them once the writes are
+// committed, their errors are recorded on the span only.
+type AuditSink interface {
+	Transactional() bool
+	WriteAudit(ctx context.Context, db Rdbms, entries []AuditEntry) error
+}
+
+type AuditConfig struct {
+	Sinks []AuditSink
+	// Redact returns the args stored in the entries of a write on table. Every
+	// arg is replaced by AuditRedacted when nil.
+	Redact func(table string, args []any) []any
+}
+
+// WithAudit records an AuditEntry for every INSERT, UPDATE, DELETE, MERGE and
+// REPLACE, executed with ExecSq or, with a RETURNING clause, with QuerySq and
+// QueryRowSq. Writes outside a transaction run in a transaction of their own
+// when a transactional sink is configured.
+func WithAudit(config AuditConfig) optionFunc {
+	return func(cfg *rdbms) {
+		if config.Redact == nil {
+			config.Redact = redactAll
+		}
+		cfg.audit = &config
+	}
+}
+
+type auditActorKey struct{}
+
+// ContextWithAuditActor sets the actor recorded in the audit entries of the
+// writes executed with the returned context.
+func ContextWithAuditActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, auditActorKey{}, actor)
+}
+
+// skipAuditKey marks the writes of the sinks themselves.
+type skipAuditKey struct{}
+
+var auditOperations = map[string]struct{}{"INSERT": {}, "UPDATE": {}, "DELETE": {}, "MERGE": {}, "REPLACE": {}}
+
+func redactAll(_ string, args []any) []any {
+	redacted := make([]any, len(args))
+	for i := range args {
+		redacted[i] = AuditRedacted
+	}
+	return redacted
+}
+
+func (s *rdbms) auditEnabled(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipAuditKey{}).(bool)
+	return s.audit != nil && !skip
+}
+
+// auditOperation returns the operation of rawQuery if it is an audited write.
+func auditOperation(rawQuery string) (string, bool) {
+	fields := strings.Fields(rawQuery)
+	if len(fields) == 0 {
+		return "", false
+	}
+	operation := strings.ToUpper(fields[0])
+	_, ok := auditOperations[operation]
+	return operation, ok
+}
+
+// audited reports whether rawQuery is a write to record in the audit log.
+func (s *rdbms) audited(ctx context.Context, rawQuery string) bool {
+	_, ok := auditOperation(rawQuery)
+	return ok && s.auditEnabled(ctx)
+}
+
+// auditInOwnTx reports whether rawQuery has to run in a transaction of its own
+// for a transactional sink to write in it.
+func (s *rdbms) auditInOwnTx(ctx context.Context, rawQuery string) bool {
+	if s.tx != nil || !s.audited(ctx, rawQuery) {
+		return false
+	}
+
+	for _, sink := range s.audit.Sinks {
+		if sink.Transactional() {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAudit creates the entry of a successful write. Inside a transaction it
+// is kept until the commit, otherwise it is written to the sinks right away.
+func (s *rdbms) recordAudit(ctx context.Context, rawQuery string, args []any, rowsAffected int64) {
+	operation, ok := auditOperation(rawQuery)
+	if !ok || !s.auditEnabled(ctx) {
+		return
+	}
+
+	table := ""
+	if tables := extractTables(rawQuery); len(tables) > 0 {
+		table = tables[0]
+	}
+	actor, _ := ctx.Value(auditActorKey{}).(string)
+
+	entry := AuditEntry{
+		Time:         time.Now(),
+		Actor:        actor,
+		Operation:    operation,
+		Table:        table,
+		SQL:          normalizeSQL(rawQuery),
+		Args:         s.audit.Redact(table, args),
+		RowsAffected: rowsAffected,
+	}
+
+	if s.tx != nil {
+		s.tx.addAuditEntry(entry)
+		return
+	}
+	s.writeAudit(ctx, []AuditEntry{entry})
+}
+
+// writeTxAudit writes the entries of the transaction tx to the transactional
+// sinks, before the commit.
+func (s *rdbms) writeTxAudit(ctx context.Context, tx *rdbms) error {
+	if s.audit == nil {
+		return nil
+	}
+	entries := tx.tx.auditSnapshot()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ctx = context.WithValue(ctx, skipAuditKey{}, true)
+	for _, sink := range s.audit.Sinks {
+		if !sink.Transactional() {
+			continue
+		}
+		if err := sink.WriteAudit(ctx, tx, entries); err != nil {
+			return fmt.Errorf("wsqlx: write audit: %w", err)
+		}
+	}
+	return nil
+}
+
+// writeAudit writes committed entries to the sinks that are not transactional.
+func (s *rdbms) writeAudit(ctx context.Context, entries []AuditEntry) {
+	if s.audit == nil || len(entries) == 0 {
+		return
+	}
+
+	ctx = context.WithValue(ctx, skipAuditKey{}, true)
+	for _, sink := range s.audit.Sinks {
+		if sink.Transactional() {
+			continue
+		}
+		if err := sink.WriteAudit(ctx, s, entries); err != nil {
+			recordError(trace.SpanFromContext(ctx), fmt.Errorf("wsqlx: write audit: %w", err))
+		}
+	}
+}
+
+// TableAuditSink inserts the entries into Table within the audited
+// transaction. The table needs the columns:
+//
+//	occurred_at TIMESTAMP, actor TEXT, operation TEXT, table_name TEXT,
+//	statement TEXT, args TEXT, rows_affected BIGINT
+//
+// args holds the redacted args as a JSON array.
+type TableAuditSink struct {
+	Table             string
+	PlaceholderFormat squirrel.PlaceholderFormat
+}
+
+func (t TableAuditSink) Transactional() bool {
+	return true
+}
+
+func (t TableAuditSink) WriteAudit(ctx context.Context, db Rdbms, entries []AuditEntry) error {
+	query := squirrel.Insert(t.Table).
+		Columns("occurred_at", "actor", "operation", "table_name", "statement", "args", "rows_affected")
+	if t.PlaceholderFormat != nil {
+		query = query.PlaceholderFormat(t.PlaceholderFormat)
+	}
+
+	for _, entry := range entries {
+		args, err := json.Marshal(entry.Args)
+		if err != nil {
+			return err
+		}
+		query = query.Values(entry.Time, entry.Actor, entry.Operation, entry.Table, entry.SQL, string(args), entry.RowsAffected)
+	}
+
+	_, err := db.ExecSq(ctx, query)
+	return err
+}
+
+// SlogAuditSink logs every entry at the info level.
+type SlogAuditSink struct {
+	Logger *slog.Logger
+}
+
+func (s SlogAuditSink) Transactional() bool {
+	return false
+}
+
+func (s SlogAuditSink) WriteAudit(ctx context.Context, _ Rdbms, entries []AuditEntry) error {
+	for _, entry := range entries {
+		s.Logger.InfoContext(ctx, "wsqlx audit",
+			slog.Time("time", entry.Time),
+			slog.String("actor", entry.Actor),
+			slog.String("operation", entry.Operation),
+			slog.String("table", entry.Table),
+			slog.String("sql", entry.SQL),
+			slog.Any("args", entry.Args),
+			slog.Int64("rows_affected", entry.RowsAffected),
+		)
+	}
+	return nil
+}
+
+// ChannelAuditSink sends every entry to C. A send blocks until C has room or
+// the context is done.
+type ChannelAuditSink struct {
+	C chan<- AuditEntry
+}
+
+func (c ChannelAuditSink) Transactional() bool {
+	return false
+}
+
+func (c ChannelAuditSink) WriteAudit(ctx context.Context, _ Rdbms, entries []AuditEntry) error {
+	for _, entry := range entries {
+		select {
+		case c.C <- entry:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package wsqlx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rdbms_Audit(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	entries := make(chan wsqlx.AuditEntry, 10)
+	sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithAudit(wsqlx.AuditConfig{
+		Sinks: []wsqlx.AuditSink{
+			wsqlx.TableAuditSink{Table: "audit_log"},
+			wsqlx.ChannelAuditSink{C: entries},
+		},
+	}))
+	ctx := wsqlx.ContextWithAuditActor(context.TODO(), "user-1")
+	insertAudit := regexp.QuoteMeta(`INSERT INTO audit_log (occurred_at,actor,operation,table_name,statement,args,rows_affected)`)
+
+	t.Run("should write the audit log in the transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?)`)).
+			WithArgs("iban").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE accounts SET balance = ? WHERE user_id = ?`)).
+			WithArgs(100, 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertAudit).
+			WithArgs(
+				sqlmock.AnyArg(), "user-1", "INSERT", "users", "INSERT INTO users (name) VALUES (?)", `["[REDACTED]"]`, int64(1),
+				sqlmock.AnyArg(), "user-1", "UPDATE", "accounts", "UPDATE accounts SET balance = ? WHERE user_id = ?", `["[REDACTED]","[REDACTED]"]`, int64(1),
+			).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			if _, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban")); err != nil {
+				return err
+			}
+			_, err := tx.ExecSq(ctx, squirrel.Update("accounts").Set("balance", 100).Where(squirrel.Eq{"user_id": 1}))
+			return err
+		})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		require.Len(t, entries, 2)
+		entry := <-entries
+		require.Equal(t, "user-1", entry.Actor)
+		require.Equal(t, "users", entry.Table)
+		<-entries
+	})
+
+	t.Run("should run writes outside a transaction in their own transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertAudit).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, err = sqlxx.ExecSq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		entry := <-entries
+		require.Equal(t, "DELETE", entry.Operation)
+	})
+
+	t.Run("should roll back when the audit log can't be written", func(t *testing.T) {
+		errAudit := errors.New("audit_log is full")
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insertAudit).WillReturnError(errAudit)
+		mock.ExpectRollback()
+
+		_, err = sqlxx.ExecSq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+		require.ErrorIs(t, err, errAudit)
+		require.NoError(t, mock.ExpectationsWereMet())
+		require.Empty(t, entries)
+	})
+
+	t.Run("should audit writes with a RETURNING clause", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?) RETURNING id`)).
+			WithArgs("iban").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectExec(insertAudit).
+			WithArgs(sqlmock.AnyArg(), "user-1", "INSERT", "users", "INSERT INTO users (name) VALUES (?) RETURNING id", `["[REDACTED]"]`, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		var id int64
+		err = sqlxx.QueryRowSq(ctx, squirrel.Insert("users").Columns("name").Values("iban").Suffix("RETURNING id"),
+			wsqlx.QueryRowScanTypeDefault, &id)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), id)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`DELETE FROM users WHERE name = ? RETURNING id`)).
+			WithArgs("iban").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+		mock.ExpectExec(insertAudit).
+			WithArgs(sqlmock.AnyArg(), "user-1", "DELETE", "users", "DELETE FROM users WHERE name = ? RETURNING id", `["[REDACTED]"]`, int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		ids := make([]int64, 0)
+		err = sqlxx.QuerySq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"name": "iban"}).Suffix("RETURNING id"), func(rows *sqlx.Rows) error {
+			for rows.Next() {
+				var id int64
+				if err := rows.Scan(&id); err != nil {
+					return err
+				}
+				ids = append(ids, id)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1, 2}, ids)
+		require.NoError(t, mock.ExpectationsWereMet())
+
+		require.Equal(t, "INSERT", (<-entries).Operation)
+		require.Equal(t, int64(2), (<-entries).RowsAffected)
+	})
+}
@@ -0,0 +1,258 @@
+package wsqlx
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	gob.Register(time.Time{})
+}
+
+// Cache is the storage used by the read-through query cache. Implementations
+// must be safe for concurrent use. Values are opaque encoded result sets, tags
+// are the table names a result was read from.
+type Cache interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, tags []string)
+	InvalidateTags(ctx context.Context, tags ...string)
+}
+
+// WithCache enables the read-through query cache. Queries are only cached when
+// the context carries a TTL, see ContextWithCacheTTL, and only SELECT and WITH
+// statements without a write or locking clause are cached. Every other
+// statement, like an INSERT ... RETURNING run through QuerySq, invalidates the
+// cached results that were read from a table it writes to.
+func WithCache(cache Cache) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.cache = cache
+	}
+}
+
+type cacheTTLKey struct{}
+
+// ContextWithCacheTTL opts the queries executed with the returned context into
+// the query cache, keeping their results for ttl. Queries inside a transaction
+// always bypass the cache.
+func ContextWithCacheTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheTTLKey{}, ttl)
+}
+
+var cacheableOperations = map[string]struct{}{"SELECT": {}, "WITH": {}}
+
+// cacheableStatement reports whether rawQuery is a read whose result can be
+// served from the cache.
+func cacheableStatement(rawQuery string) bool {
+	stmt := stringLiteralRegex.ReplaceAllString(normalizeSQL(rawQuery), "?")
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return false
+	}
+
+	_, ok := cacheableOperations[strings.ToUpper(fields[0])]
+	return ok && !writeKeywordRegex.MatchString(stmt)
+}
+
+func (s *rdbms) cacheTTL(ctx context.Context, rawQuery string) (time.Duration, bool) {
+	if s.cache == nil || s.tx != nil || s.tenant != nil || !cacheableStatement(rawQuery) {
+		return 0, false
+	}
+
+	ttl, ok := ctx.Value(cacheTTLKey{}).(time.Duration)
+	return ttl, ok && ttl > 0
+}
+
+func cacheKey(rawQuery string, args []any) string {
+	h := sha256.New()
+	h.Write([]byte(normalizeSQL(rawQuery)))
+	for _, arg := range args {
+		arg = cacheKeyArg(arg)
+		fmt.Fprintf(h, "\x00%T:%v", arg, arg)
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheKeyArg resolves pointer and driver.Valuer args to the value sent to the
+// database, so the key does not depend on memory addresses.
+func cacheKeyArg(arg any) any {
+	for i := 0; i < 8; i++ {
+		v := reflect.ValueOf(arg)
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil
+		}
+		if valuer, ok := arg.(driver.Valuer); ok {
+			value, err := valuer.Value()
+			if err != nil {
+				return arg
+			}
+			arg = value
+			continue
+		}
+		if v.Kind() != reflect.Ptr {
+			return arg
+		}
+		arg = v.Elem().Interface()
+	}
+	return arg
+}
+
+// cachedRows serves the result of rawQuery from the cache, falling back to the
+// database and storing the result on a miss.
+func (s *rdbms) cachedRows(ctx context.Context, rawQuery string, args []any, ttl time.Duration) (*materializedRows, bool, error) {
+	key := cacheKey(rawQuery, args)
+	if value, ok := s.cache.Get(ctx, key); ok {
+		rows := &materializedRows{}
+		if err := gob.NewDecoder(bytes.NewReader(value)).Decode(rows); err == nil {
+			return rows, true, nil
+		}
+	}
+
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	res, err := s.queryx(ctx, rawQuery, args)
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Close()
+
+	rows, err := materializeRows(res)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(rows); err == nil {
+		s.cache.Set(ctx, key, buf.Bytes(), ttl, extractTables(rawQuery))
+	}
+
+	return rows, false, nil
+}
+
+func (s *rdbms) invalidateCache(ctx context.Context, rawQuery string) {
+	if s.cache == nil {
+		return
+	}
+
+	tables := extractTables(rawQuery)
+	if len(tables) == 0 {
+		return
+	}
+
+	if s.tx != nil {
+		s.tx.addPendingInvalidation(tables...)
+		return
+	}
+	s.cache.InvalidateTags(ctx, tables...)
+}
+
+// NewMemoryCache returns an in-memory LRU Cache holding at most size entries.
+func NewMemoryCache(size int) *memoryCache {
+	return &memoryCache{
+		size:    size,
+		entries: list.New(),
+		items:   make(map[string]*list.Element),
+		tags:    make(map[string]map[string]struct{}),
+	}
+}
+
+type memoryCache struct {
+	mu      sync.Mutex
+	size    int
+	entries *list.List
+	items   map[string]*list.Element
+	tags    map[string]map[string]struct{}
+}
+
+type memoryCacheEntry struct {
+	key       string
+	value     []byte
+	tags      []string
+	expiredAt time.Time
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*memoryCacheEntry)
+	if time.Now().After(entry.expiredAt) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.entries.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *memoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration, tags []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+
+	entry := &memoryCacheEntry{
+		key:       key,
+		value:     value,
+		tags:      tags,
+		expiredAt: time.Now().Add(ttl),
+	}
+	c.items[key] = c.entries.PushFront(entry)
+	for _, tag := range tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = make(map[string]struct{})
+		}
+		c.tags[tag][key] = struct{}{}
+	}
+
+	for c.size > 0 && c.entries.Len() > c.size {
+		c.remove(c.entries.Back())
+	}
+}
+
+func (c *memoryCache) InvalidateTags(_ context.Context, tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if element, ok := c.items[key]; ok {
+				c.remove(element)
+			}
+		}
+		delete(c.tags, tag)
+	}
+}
+
+func (c *memoryCache) remove(element *list.Element) {
+	entry := element.Value.(*memoryCacheEntry)
+	c.entries.Remove(element)
+	delete(c.items, entry.key)
+	for _, tag := range entry.tags {
+		delete(c.tags[tag], entry.key)
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
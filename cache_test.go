@@ -0,0 +1,127 @@
+package wsqlx_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rdbms_Cache(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+	sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithCache(wsqlx.NewMemoryCache(10)))
+	ctx := wsqlx.ContextWithCacheTTL(context.TODO(), time.Minute)
+
+	query := squirrel.Select("id", "name").From("users").Where(squirrel.Eq{"id": 1})
+	type user struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	t.Run("should serve the second query from cache", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "iban"))
+
+		for i := 0; i < 2; i++ {
+			var got user
+			err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeStruct, &got)
+			require.NoError(t, err)
+			require.Equal(t, user{ID: 1, Name: "iban"}, got)
+		}
+
+		err = sqlxx.QuerySq(ctx, query, func(rows *sqlx.Rows) (err error) {
+			for rows.Next() {
+				var got user
+				require.NoError(t, rows.StructScan(&got))
+				require.Equal(t, user{ID: 1, Name: "iban"}, got)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should invalidate cache after write on the same table", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET name = ? WHERE id = ?`)).
+			WithArgs("rama", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "rama"))
+
+		_, err = sqlxx.ExecSq(ctx, squirrel.Update("users").Set("name", "rama").Where(squirrel.Eq{"id": 1}))
+		require.NoError(t, err)
+
+		var got user
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeStruct, &got)
+		require.NoError(t, err)
+		require.Equal(t, "rama", got.Name)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should key pointer and valuer args by their value", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name FROM users WHERE id = ? AND name = ?`)).
+			WithArgs(2, "iban").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "iban"))
+
+		for i := 0; i < 2; i++ {
+			id := int64(2)
+			name := sql.NullString{String: "iban", Valid: true}
+			var got user
+			err = sqlxx.QueryRowSq(ctx, squirrel.Select("id", "name").From("users").Where("id = ? AND name = ?", &id, name),
+				wsqlx.QueryRowScanTypeStruct, &got)
+			require.NoError(t, err)
+			require.Equal(t, user{ID: 2, Name: "iban"}, got)
+		}
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("should run writes with RETURNING every time and invalidate cache", func(t *testing.T) {
+		insert := squirrel.Insert("users").Columns("name").Values("iban").Suffix("RETURNING id")
+
+		for i := 0; i < 2; i++ {
+			mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?) RETURNING id`)).
+				WithArgs("iban").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(int64(3 + i)))
+		}
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, name FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "iban"))
+
+		var got user
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeStruct, &got)
+		require.NoError(t, err)
+		require.Equal(t, "rama", got.Name)
+
+		for i := 0; i < 2; i++ {
+			var id int64
+			err = sqlxx.QueryRowSq(ctx, insert, wsqlx.QueryRowScanTypeDefault, &id)
+			require.NoError(t, err)
+			require.Equal(t, int64(3+i), id)
+		}
+
+		err = sqlxx.QuerySq(ctx, query, func(rows *sqlx.Rows) error {
+			require.True(t, rows.Next())
+			require.NoError(t, rows.StructScan(&got))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, "iban", got.Name)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
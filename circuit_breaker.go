@@ -0,0 +1,282 @@
+package wsqlx
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ErrCircuitOpen is returned without touching the database while the circuit
+// breaker is open.
+var ErrCircuitOpen = errors.New("wsqlx: circuit breaker is open")
+
+type CircuitState uint8
+
+const (
+	CircuitStateClosed CircuitState = iota + 1
+	CircuitStateOpen
+	CircuitStateHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitStateClosed:
+		return "closed"
+	case CircuitStateOpen:
+		return "open"
+	case CircuitStateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig configures the circuit breaker around the database pool.
+type CircuitBreakerConfig struct {
+	// FailureRateThreshold opens the circuit once the share of failed calls in
+	// the current window reaches it (0 to 1), 0.5 when out of range.
+	FailureRateThreshold float64
+	// MinRequests is the number of calls a window needs before the failure rate
+	// is evaluated, 10 when zero.
+	MinRequests int
+	// Window is the period over which calls are counted, 1 minute when zero.
+	Window time.Duration
+	// OpenTimeout is how long the circuit stays open before half-opening, 30
+	// seconds when zero.
+	OpenTimeout time.Duration
+	// HalfOpenMaxRequests is the number of probe calls allowed while half-open.
+	// All of them have to succeed for the circuit to close again. 1 when zero.
+	HalfOpenMaxRequests int
+	// IsFailure classifies errors as connection failures. IsTransientError is
+	// used when nil, any other error counts as a successful call.
+	IsFailure func(err error) bool
+	// OnStateChange is called after every state change.
+	OnStateChange func(from, to CircuitState)
+	// Logger receives a record on every state change. slog.Default is used when nil.
+	Logger *slog.Logger
+}
+
+// WithCircuitBreaker enables failing fast with ErrCircuitOpen while the
+// database is unreachable.
+func WithCircuitBreaker(config CircuitBreakerConfig) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.circuitBreakerConfig = &config
+	}
+}
+
+// circuitBreakerIDs numbers the circuit breakers of the process, so breakers of
+// separate rdbms reporting to the same meter provider don't share an id.
+var circuitBreakerIDs atomic.Int64
+
+// circuitBreakerMetrics holds the instruments shared by the circuit breakers of
+// an rdbms and of its Derive copies, so the state gauge is registered once and
+// reports every breaker under its own db.circuit_breaker.id.
+type circuitBreakerMetrics struct {
+	stateChanges metric.Int64Counter
+
+	mu       sync.Mutex
+	breakers []*circuitBreaker
+}
+
+func newCircuitBreakerMetrics(meter metric.Meter) *circuitBreakerMetrics {
+	m := &circuitBreakerMetrics{}
+	m.stateChanges, _ = meter.Int64Counter("db.client.circuit_breaker.state_changes",
+		metric.WithDescription("The number of circuit breaker state changes"))
+	_, _ = meter.Int64ObservableGauge("db.client.circuit_breaker.state",
+		metric.WithDescription("The circuit breaker state: 1 closed, 2 open, 3 half-open"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			m.mu.Lock()
+			breakers := append([]*circuitBreaker(nil), m.breakers...)
+			m.mu.Unlock()
+
+			for _, c := range breakers {
+				o.Observe(int64(c.State()), metric.WithAttributes(c.attrs...))
+			}
+			return nil
+		}))
+
+	return m
+}
+
+func (m *circuitBreakerMetrics) newCircuitBreaker(config CircuitBreakerConfig) *circuitBreaker {
+	if config.IsFailure == nil {
+		config.IsFailure = IsTransientError
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if config.FailureRateThreshold <= 0 || config.FailureRateThreshold > 1 {
+		config.FailureRateThreshold = 0.5
+	}
+	if config.MinRequests <= 0 {
+		config.MinRequests = 10
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = 30 * time.Second
+	}
+	if config.HalfOpenMaxRequests <= 0 {
+		config.HalfOpenMaxRequests = 1
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c := &circuitBreaker{
+		config:       config,
+		attrs:        []attribute.KeyValue{attribute.Int64("db.circuit_breaker.id", circuitBreakerIDs.Add(1))},
+		state:        CircuitStateClosed,
+		windowStart:  time.Now(),
+		stateChanges: m.stateChanges,
+	}
+	m.breakers = append(m.breakers, c)
+
+	return c
+}
+
+type circuitBreaker struct {
+	config       CircuitBreakerConfig
+	attrs        []attribute.KeyValue
+	stateChanges metric.Int64Counter
+
+	mu          sync.Mutex
+	state       CircuitState
+	openedAt    time.Time
+	windowStart time.Time
+	requests    int
+	failures    int
+	probes      int
+	successes   int
+}
+
+func (c *circuitBreaker) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *circuitBreaker) do(ctx context.Context, fn func() error) error {
+	if err := c.allow(ctx); err != nil {
+		return err
+	}
+
+	err := fn()
+	if ctx.Err() != nil {
+		// A call ended by its own context says nothing about the database.
+		c.discard()
+		return err
+	}
+	c.record(ctx, err != nil && c.config.IsFailure(err))
+	return err
+}
+
+func (c *circuitBreaker) allow(ctx context.Context) error {
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitStateOpen:
+		if time.Since(c.openedAt) < c.config.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		notify = c.setState(ctx, CircuitStateHalfOpen)
+	case CircuitStateHalfOpen:
+		if c.probes >= c.config.HalfOpenMaxRequests {
+			return ErrCircuitOpen
+		}
+	}
+
+	if c.state == CircuitStateHalfOpen {
+		c.probes++
+	}
+	return nil
+}
+
+// discard gives the slot of a call that is not recorded back to the probes.
+func (c *circuitBreaker) discard() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.state == CircuitStateHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+func (c *circuitBreaker) record(ctx context.Context, failed bool) {
+	var notify func()
+	defer func() {
+		if notify != nil {
+			notify()
+		}
+	}()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch c.state {
+	case CircuitStateHalfOpen:
+		if failed {
+			notify = c.setState(ctx, CircuitStateOpen)
+			return
+		}
+		c.successes++
+		if c.successes >= c.config.HalfOpenMaxRequests {
+			notify = c.setState(ctx, CircuitStateClosed)
+		}
+	case CircuitStateClosed:
+		if time.Since(c.windowStart) > c.config.Window {
+			c.windowStart = time.Now()
+			c.requests, c.failures = 0, 0
+		}
+
+		c.requests++
+		if !failed {
+			return
+		}
+		c.failures++
+		if c.requests >= c.config.MinRequests &&
+			float64(c.failures)/float64(c.requests) >= c.config.FailureRateThreshold {
+			notify = c.setState(ctx, CircuitStateOpen)
+		}
+	}
+}
+
+// setState must be called with c.mu held. The returned function reports the
+// change and has to be called after c.mu is released.
+func (c *circuitBreaker) setState(ctx context.Context, state CircuitState) func() {
+	from := c.state
+	c.state = state
+	c.probes, c.successes = 0, 0
+	c.requests, c.failures = 0, 0
+	c.windowStart = time.Now()
+	if state == CircuitStateOpen {
+		c.openedAt = time.Now()
+	}
+
+	return func() {
+		c.config.Logger.WarnContext(ctx, "wsqlx circuit breaker state changed",
+			slog.String("from", from.String()), slog.String("to", state.String()))
+		if c.stateChanges != nil {
+			c.stateChanges.Add(ctx, 1, metric.WithAttributes(c.attrs...), metric.WithAttributes(
+				attribute.String("db.circuit_breaker.from", from.String()),
+				attribute.String("db.circuit_breaker.to", state.String()),
+			))
+		}
+		if c.config.OnStateChange != nil {
+			c.config.OnStateChange(from, state)
+		}
+	}
+}
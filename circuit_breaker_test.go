@@ -0,0 +1,254 @@
+package wsqlx_test
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/embedded"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+func Test_rdbms_CircuitBreaker(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	var states []wsqlx.CircuitState
+	sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{
+		FailureRateThreshold: 0.5,
+		MinRequests:          2,
+		Window:               time.Minute,
+		OpenTimeout:          time.Minute,
+		OnStateChange: func(from, to wsqlx.CircuitState) {
+			states = append(states, to)
+		},
+	}))
+
+	query := squirrel.Select("id").From("users").Where(squirrel.Eq{"id": 1})
+
+	t.Run("should fail fast after the failure rate is reached", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+				WithArgs(1).
+				WillReturnError(errConnReset)
+
+			var id int
+			err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+			require.ErrorIs(t, err, errConnReset)
+		}
+
+		var id int
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.ErrorIs(t, err, wsqlx.ErrCircuitOpen)
+		require.Equal(t, []wsqlx.CircuitState{wsqlx.CircuitStateOpen}, states)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should stay closed on success with the default config", func(t *testing.T) {
+		var states []wsqlx.CircuitState
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{
+			OnStateChange: func(from, to wsqlx.CircuitState) {
+				states = append(states, to)
+			},
+		}))
+
+		for i := 0; i < 2; i++ {
+			mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+				WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+			var id int
+			err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+			require.NoError(t, err)
+		}
+		require.Empty(t, states)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should close after HalfOpenMaxRequests successful probes", func(t *testing.T) {
+		sqlxx, states := newHalfOpenRdbms(t, sqlxDB, mock, 2)
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillDelayFor(50 * time.Millisecond).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillDelayFor(50 * time.Millisecond).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() {
+				var id int
+				errs <- sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+			}()
+		}
+
+		// Both probes are in flight, so the circuit stays half-open until they end.
+		time.Sleep(20 * time.Millisecond)
+		var id int
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.ErrorIs(t, err, wsqlx.ErrCircuitOpen)
+
+		require.NoError(t, <-errs)
+		require.NoError(t, <-errs)
+		require.Equal(t, []wsqlx.CircuitState{wsqlx.CircuitStateOpen, wsqlx.CircuitStateHalfOpen, wsqlx.CircuitStateClosed}, *states)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should reopen on a failed probe", func(t *testing.T) {
+		sqlxx, states := newHalfOpenRdbms(t, sqlxDB, mock, 1)
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnError(errConnReset)
+
+		var id int
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.ErrorIs(t, err, errConnReset)
+
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.ErrorIs(t, err, wsqlx.ErrCircuitOpen)
+		require.Equal(t, []wsqlx.CircuitState{wsqlx.CircuitStateOpen, wsqlx.CircuitStateHalfOpen, wsqlx.CircuitStateOpen}, *states)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not count a probe ended by its own context", func(t *testing.T) {
+		sqlxx, states := newHalfOpenRdbms(t, sqlxDB, mock, 1)
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillDelayFor(time.Second).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		probeCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		var id int
+		err = sqlxx.QueryRowSq(probeCtx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.Error(t, err)
+		require.Equal(t, []wsqlx.CircuitState{wsqlx.CircuitStateOpen, wsqlx.CircuitStateHalfOpen}, *states)
+
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.NoError(t, err)
+		require.Equal(t, []wsqlx.CircuitState{wsqlx.CircuitStateOpen, wsqlx.CircuitStateHalfOpen, wsqlx.CircuitStateClosed}, *states)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should register the state gauge once and report each breaker", func(t *testing.T) {
+		mp := &gaugeMeterProvider{}
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithMeterProvider(mp), wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{}))
+		sqlxx.Derive(wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{}))
+		sqlxx.Derive(wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{}))
+
+		require.Len(t, mp.meter.callbacks, 1)
+		observer := &gaugeObserver{}
+		require.NoError(t, mp.meter.callbacks[0](ctx, observer))
+		require.Equal(t, []int64{1, 1, 1}, observer.values)
+		require.Len(t, observer.ids(), 3)
+	})
+
+	t.Run("should report the breakers of separate rdbms under distinct ids", func(t *testing.T) {
+		mp := &gaugeMeterProvider{}
+		wsqlx.NewRdbms(sqlxDB, wsqlx.WithMeterProvider(mp), wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{}))
+		wsqlx.NewRdbms(sqlxDB, wsqlx.WithMeterProvider(mp), wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{}))
+
+		require.Len(t, mp.meter.callbacks, 2)
+		observer := &gaugeObserver{}
+		for _, callback := range mp.meter.callbacks {
+			require.NoError(t, callback(ctx, observer))
+		}
+		require.Equal(t, []int64{1, 1}, observer.values)
+		require.Len(t, observer.ids(), 2)
+	})
+}
+
+// newHalfOpenRdbms returns an rdbms whose circuit breaker has been opened by a
+// failed call and whose open timeout has elapsed.
+func newHalfOpenRdbms(t *testing.T, db *sqlx.DB, mock sqlmock.Sqlmock, halfOpenMaxRequests int) (wsqlx.Rdbms, *[]wsqlx.CircuitState) {
+	var mu sync.Mutex
+	states := &[]wsqlx.CircuitState{}
+	sqlxx := wsqlx.NewRdbms(db, wsqlx.WithCircuitBreaker(wsqlx.CircuitBreakerConfig{
+		MinRequests:         1,
+		OpenTimeout:         10 * time.Millisecond,
+		HalfOpenMaxRequests: halfOpenMaxRequests,
+		OnStateChange: func(from, to wsqlx.CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			*states = append(*states, to)
+		},
+	}))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+		WithArgs(1).
+		WillReturnError(errConnReset)
+
+	var id int
+	err := sqlxx.QueryRowSq(context.TODO(), squirrel.Select("id").From("users").Where(squirrel.Eq{"id": 1}),
+		wsqlx.QueryRowScanTypeDefault, &id)
+	require.ErrorIs(t, err, errConnReset)
+	require.Equal(t, []wsqlx.CircuitState{wsqlx.CircuitStateOpen}, *states)
+
+	time.Sleep(20 * time.Millisecond)
+	return sqlxx, states
+}
+
+type gaugeMeterProvider struct {
+	noop.MeterProvider
+	meter gaugeMeter
+}
+
+func (p *gaugeMeterProvider) Meter(string, ...metric.MeterOption) metric.Meter {
+	return &p.meter
+}
+
+type gaugeMeter struct {
+	noop.Meter
+	callbacks []metric.Int64Callback
+}
+
+func (m *gaugeMeter) Int64ObservableGauge(name string, opts ...metric.Int64ObservableGaugeOption) (metric.Int64ObservableGauge, error) {
+	cfg := metric.NewInt64ObservableGaugeConfig(opts...)
+	m.callbacks = append(m.callbacks, cfg.Callbacks()...)
+	return m.Meter.Int64ObservableGauge(name, opts...)
+}
+
+type gaugeObserver struct {
+	embedded.Int64Observer
+	values []int64
+	attrs  []attribute.Set
+}
+
+func (o *gaugeObserver) Observe(value int64, opts ...metric.ObserveOption) {
+	o.values = append(o.values, value)
+	o.attrs = append(o.attrs, metric.NewObserveConfig(opts).Attributes())
+}
+
+// ids returns the distinct db.circuit_breaker.id values observed.
+func (o *gaugeObserver) ids() map[int64]struct{} {
+	ids := make(map[int64]struct{})
+	for _, attrs := range o.attrs {
+		if id, ok := attrs.Value("db.circuit_breaker.id"); ok {
+			ids[id.AsInt64()] = struct{}{}
+		}
+	}
+	return ids
+}
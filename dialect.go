@@ -0,0 +1,43 @@
+package wsqlx
+
+// Dialect identifies the SQL dialect of the database behind rdbms, for the
+// features that need database specific statements.
+type Dialect uint8
+
+const (
+	DialectUnknown Dialect = iota
+	DialectPostgres
+	DialectMySQL
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectPostgres:
+		return "postgresql"
+	case DialectMySQL:
+		return "mysql"
+	default:
+		return "unknown"
+	}
+}
+
+// WithDialect sets the SQL dialect. By default it is detected from the driver
+// name of the *sqlx.DB.
+func WithDialect(dialect Dialect) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.dialect = dialect
+	}
+}
+
+// detectDialect maps the driver names sqlx knows the bind type of to their
+// dialect.
+func detectDialect(driverName string) Dialect {
+	switch driverName {
+	case "postgres", "pgx", "pq-timeouts", "cloudsqlpostgres", "nrpostgres", "cockroach":
+		return DialectPostgres
+	case "mysql", "nrmysql":
+		return DialectMySQL
+	default:
+		return DialectUnknown
+	}
+}
@@ -0,0 +1,123 @@
+package wsqlx
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithEstimatedCount makes QuerySqPagination return an estimated total instead
+// of running the count query when the estimate exceeds threshold. Postgres
+// estimates come from the EXPLAIN plan of the data query, MySQL estimates from
+// the table statistics in information_schema. As those count the whole table,
+// MySQL queries with a WHERE, JOIN, GROUP BY, HAVING or UNION, or reading more
+// than one table, always run the count query. The output of an estimated count
+// has IsEstimate set, pages beyond the estimate follow the OutOfRangeBehaviour.
+// Estimates are kept for a minute per query and args, so paging through the
+// same result set costs a single estimate round trip.
+func WithEstimatedCount(threshold int64) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.estimateThreshold = threshold
+		cfg.estimates = NewMemoryCache(1000)
+	}
+}
+
+const estimateTTL = time.Minute
+
+var errEstimateUnsupported = errors.New("wsqlx: count estimate is not supported for this dialect or query")
+
+// filteredQueryRegex matches the clauses that make a query return fewer or
+// other rows than its table holds.
+var filteredQueryRegex = regexp.MustCompile(`(?i)\b(?:WHERE|JOIN|GROUP\s+BY|HAVING|UNION)\b`)
+
+// cachedEstimateCount returns the estimate of query kept from a previous call,
+// or estimates it. Errors are recorded on the span of the estimate.
+func (s *rdbms) cachedEstimateCount(ctx context.Context, query squirrel.SelectBuilder) (estimate int64, err error) {
+	ctx, span := s.tracer.Start(ctx, "estimate count", trace.WithSpanKind(trace.SpanKindInternal))
+	defer span.End()
+
+	rawQuery, args, err := query.ToSql()
+	if err != nil {
+		recordError(span, err)
+		return 0, err
+	}
+
+	key := cacheKey(rawQuery, args)
+	if value, ok := s.estimates.Get(ctx, key); ok && len(value) == 8 {
+		estimate = int64(binary.BigEndian.Uint64(value))
+		span.SetAttributes(DBCacheHit.Bool(true), DBCountEstimate.Int64(estimate))
+		return estimate, nil
+	}
+
+	estimate, err = s.estimateCount(ctx, query)
+	if err != nil {
+		recordError(span, err)
+		return 0, err
+	}
+	s.estimates.Set(ctx, key, binary.BigEndian.AppendUint64(nil, uint64(estimate)), estimateTTL, nil)
+	span.SetAttributes(DBCacheHit.Bool(false), DBCountEstimate.Int64(estimate))
+
+	return estimate, nil
+}
+
+// estimateCount returns the estimated number of rows returned by query.
+func (s *rdbms) estimateCount(ctx context.Context, query squirrel.SelectBuilder) (int64, error) {
+	switch s.dialect {
+	case DialectPostgres:
+		rawQuery, args, err := query.ToSql()
+		if err != nil {
+			return 0, err
+		}
+
+		var plan []byte
+		err = s.QueryRowSq(ctx, squirrel.Expr("EXPLAIN (FORMAT JSON) "+rawQuery, args...), QueryRowScanTypeDefault, &plan)
+		if err != nil {
+			return 0, err
+		}
+
+		return parsePostgresPlanRows(plan)
+	case DialectMySQL:
+		rawQuery, _, err := query.ToSql()
+		if err != nil {
+			return 0, err
+		}
+
+		tables := extractTables(rawQuery)
+		stmt := stringLiteralRegex.ReplaceAllString(rawQuery, "?")
+		if len(tables) != 1 || filteredQueryRegex.MatchString(stmt) {
+			return 0, errEstimateUnsupported
+		}
+
+		var rows int64
+		err = s.QueryRowSq(ctx, squirrel.Select("TABLE_ROWS").
+			From("information_schema.TABLES").
+			Where("TABLE_SCHEMA = DATABASE()").
+			Where(squirrel.Eq{"TABLE_NAME": tables[0]}), QueryRowScanTypeDefault, &rows)
+		return rows, err
+	default:
+		return 0, errEstimateUnsupported
+	}
+}
+
+func parsePostgresPlanRows(plan []byte) (int64, error) {
+	var explain []struct {
+		Plan struct {
+			PlanRows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	if err := json.Unmarshal(plan, &explain); err != nil {
+		return 0, err
+	}
+	if len(explain) == 0 {
+		return 0, fmt.Errorf("wsqlx: empty explain plan")
+	}
+
+	return int64(explain[0].Plan.PlanRows), nil
+}
@@ -0,0 +1,20 @@
+// Package sqltext holds the SQL text helpers shared by wsqlx and its
+// subpackages.
+package sqltext
+
+import (
+	"regexp"
+	"strings"
+)
+
+var whitespaceRegex = regexp.MustCompile(`\s+`)
+
+// NumberedPlaceholderRegex matches the numbered placeholders of the Dollar,
+// AtP and Colon placeholder formats: $1, @p1 and :1.
+var NumberedPlaceholderRegex = regexp.MustCompile(`\$\d+|@p\d+|:\d+`)
+
+// Normalize collapses every run of whitespace into a single space, so
+// statements that differ only in formatting are treated as the same statement.
+func Normalize(stmt string) string {
+	return strings.TrimSpace(whitespaceRegex.ReplaceAllString(stmt, " "))
+}
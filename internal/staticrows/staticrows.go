@@ -0,0 +1,142 @@
+// Package staticrows implements a database/sql driver serving fixed result
+// sets. It is used to hand results that did not come from the database, e.g.
+// cached, recorded or fabricated ones, to code expecting *sqlx.Rows.
+package staticrows
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Rows is a fully read result set. The values must be valid driver.Value types.
+type Rows struct {
+	Columns []string
+	Values  [][]any
+}
+
+// Read reads the remaining rows of rows, without closing it.
+func Read(rows *sql.Rows) (*Rows, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Rows{Columns: columns, Values: make([][]any, 0)}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err = rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		r.Values = append(r.Values, values)
+	}
+
+	return r, rows.Err()
+}
+
+var shared = sync.OnceValue(func() *sql.DB {
+	return sql.OpenDB(&connector{})
+})
+
+// Query serves r as *sqlx.Rows from a database shared by every caller. The
+// returned rows use the driver name and mapper of db, so StructScan behaves
+// exactly like it does against the real database. db can be nil.
+func (r *Rows) Query(ctx context.Context, db *sqlx.DB) (*sqlx.Rows, error) {
+	return replayDB(db).QueryxContext(ctx, "", r)
+}
+
+// QueryRow serves the first row of r like Query.
+func (r *Rows) QueryRow(ctx context.Context, db *sqlx.DB) *sqlx.Row {
+	return replayDB(db).QueryRowxContext(ctx, "", r)
+}
+
+func replayDB(db *sqlx.DB) *sqlx.DB {
+	if db == nil {
+		return sqlx.NewDb(shared(), "staticrows")
+	}
+
+	replay := sqlx.NewDb(shared(), db.DriverName())
+	replay.Mapper = db.Mapper
+	return replay
+}
+
+type connector struct{}
+
+func (c *connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return staticDriver{}
+}
+
+type staticDriver struct{}
+
+func (staticDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("staticrows: driver must be used through a connector")
+}
+
+type conn struct{}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("staticrows: prepared statements are not supported")
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("staticrows: transactions are not supported")
+}
+
+// CheckNamedValue passes the *Rows argument through without conversion.
+func (c *conn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c *conn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 1 {
+		return nil, errors.New("staticrows: the result set has to be the only argument")
+	}
+	r, ok := args[0].Value.(*Rows)
+	if !ok {
+		return nil, errors.New("staticrows: the result set has to be the only argument")
+	}
+
+	return &rows{columns: r.Columns, values: r.Values}, nil
+}
+
+type rows struct {
+	columns []string
+	values  [][]any
+	pos     int
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.values) {
+		return io.EOF
+	}
+	for i, v := range r.values[r.pos] {
+		dest[i] = v
+	}
+	r.pos++
+	return nil
+}
@@ -0,0 +1,85 @@
+package wsqlx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/semaphore"
+)
+
+// ErrLimiterQueueTimeout is returned when a query waited longer than the queue
+// timeout of its Limiter.
+var ErrLimiterQueueTimeout = errors.New("wsqlx: timed out waiting for a concurrency limiter slot")
+
+// Limiter caps the weight of the queries in flight at the same time. A Limiter
+// can be passed to several Rdbms instances to make them share the same limit.
+type Limiter struct {
+	sem          *semaphore.Weighted
+	size         int64
+	queueTimeout time.Duration
+}
+
+// NewLimiter returns a Limiter allowing size units of query weight in flight.
+// Queries waiting longer than queueTimeout fail with ErrLimiterQueueTimeout,
+// a zero queueTimeout waits until the context is done. A size of 0 or less
+// means unlimited, the Limiter never makes a query wait.
+func NewLimiter(size int64, queueTimeout time.Duration) *Limiter {
+	return &Limiter{
+		sem:          semaphore.NewWeighted(size),
+		size:         size,
+		queueTimeout: queueTimeout,
+	}
+}
+
+// WithLimiter limits the concurrent QuerySq, ExecSq and QueryRowSq calls. Queries
+// inside a transaction already hold a connection and are not limited.
+func WithLimiter(limiter *Limiter) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.limiter = limiter
+	}
+}
+
+type queryWeightKey struct{}
+
+// ContextWithQueryWeight sets the weight the queries executed with the returned
+// context take from the Limiter. The default weight is 1.
+func ContextWithQueryWeight(ctx context.Context, weight int64) context.Context {
+	return context.WithValue(ctx, queryWeightKey{}, weight)
+}
+
+// acquire waits for a limiter slot and records the wait time on the span in ctx.
+// The returned function releases the slot.
+func (s *rdbms) acquire(ctx context.Context) (func(), error) {
+	if s.limiter == nil || s.limiter.size <= 0 || s.tx != nil {
+		return func() {}, nil
+	}
+
+	weight, ok := ctx.Value(queryWeightKey{}).(int64)
+	if !ok || weight <= 0 {
+		weight = 1
+	}
+	if weight > s.limiter.size {
+		weight = s.limiter.size
+	}
+
+	waitCtx := ctx
+	if s.limiter.queueTimeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, s.limiter.queueTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := s.limiter.sem.Acquire(waitCtx, weight)
+	trace.SpanFromContext(ctx).SetAttributes(DBLimiterWait.Int64(time.Since(start).Milliseconds()))
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, ErrLimiterQueueTimeout
+	}
+
+	return func() { s.limiter.sem.Release(weight) }, nil
+}
@@ -0,0 +1,183 @@
+package wsqlx_test
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func Test_rdbms_Limiter(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+	query := squirrel.Select("id").From("users").Where(squirrel.Eq{"id": 1})
+
+	expectQuery := func() {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	}
+
+	// hold runs a query on db that keeps its limiter slot until the returned
+	// function is called.
+	hold := func(t *testing.T, db wsqlx.Rdbms) func() {
+		expectQuery()
+		held := make(chan struct{})
+		done := make(chan struct{})
+		errs := make(chan error, 1)
+		go func() {
+			errs <- db.QuerySq(ctx, query, func(rows *sqlx.Rows) error {
+				close(held)
+				<-done
+				return nil
+			})
+		}()
+		<-held
+		t.Cleanup(func() { require.NoError(t, <-errs) })
+
+		return func() { close(done) }
+	}
+
+	t.Run("should cap a weight above the limiter size", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithLimiter(wsqlx.NewLimiter(2, 50*time.Millisecond)))
+		expectQuery()
+
+		var id int
+		err = sqlxx.QueryRowSq(wsqlx.ContextWithQueryWeight(ctx, 5), query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.NoError(t, err)
+		require.Equal(t, 1, id)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return ErrLimiterQueueTimeout after the queue timeout", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithLimiter(wsqlx.NewLimiter(1, 20*time.Millisecond)))
+		release := hold(t, sqlxx)
+		defer release()
+
+		var id int
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.ErrorIs(t, err, wsqlx.ErrLimiterQueueTimeout)
+	})
+
+	t.Run("should return the context error when canceled while waiting", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithLimiter(wsqlx.NewLimiter(1, 0)))
+		release := hold(t, sqlxx)
+		defer release()
+
+		waitCtx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(20*time.Millisecond, cancel)
+
+		var id int
+		err = sqlxx.QueryRowSq(waitCtx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.ErrorIs(t, err, context.Canceled)
+		require.NotErrorIs(t, err, wsqlx.ErrLimiterQueueTimeout)
+	})
+
+	t.Run("should record the wait time on the span", func(t *testing.T) {
+		tp := &attributeTracerProvider{}
+		otel.SetTracerProvider(tp)
+		defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithLimiter(wsqlx.NewLimiter(1, time.Second)))
+		release := hold(t, sqlxx)
+		time.AfterFunc(30*time.Millisecond, release)
+		expectQuery()
+
+		var id int
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.NoError(t, err)
+
+		waits := tp.values(wsqlx.DBLimiterWait)
+		require.Len(t, waits, 2)
+		require.Less(t, waits[0].AsInt64(), int64(20))
+		require.GreaterOrEqual(t, waits[1].AsInt64(), int64(20))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should share the limiter of the parent with a Derive copy", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithLimiter(wsqlx.NewLimiter(1, 20*time.Millisecond)))
+		derived := sqlxx.Derive(wsqlx.WithOutIncludeQueryParameters())
+		release := hold(t, sqlxx)
+		defer release()
+
+		var id int
+		err = derived.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.ErrorIs(t, err, wsqlx.ErrLimiterQueueTimeout)
+	})
+
+	t.Run("should give a Derive copy its own limiter", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithLimiter(wsqlx.NewLimiter(1, 20*time.Millisecond)))
+		derived := sqlxx.Derive(wsqlx.WithLimiter(wsqlx.NewLimiter(1, 20*time.Millisecond)))
+		release := hold(t, sqlxx)
+		defer release()
+		expectQuery()
+
+		var id int
+		err = derived.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// attributeTracerProvider records the attributes set on the spans it starts.
+type attributeTracerProvider struct {
+	noop.TracerProvider
+
+	mu    sync.Mutex
+	attrs []attribute.KeyValue
+}
+
+func (p *attributeTracerProvider) Tracer(string, ...trace.TracerOption) trace.Tracer {
+	return attributeTracer{provider: p}
+}
+
+func (p *attributeTracerProvider) values(key attribute.Key) []attribute.Value {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var values []attribute.Value
+	for _, attr := range p.attrs {
+		if attr.Key == key {
+			values = append(values, attr.Value)
+		}
+	}
+	return values
+}
+
+type attributeTracer struct {
+	noop.Tracer
+	provider *attributeTracerProvider
+}
+
+func (t attributeTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := t.Tracer.Start(ctx, name, opts...)
+	span = attributeSpan{Span: span, provider: t.provider}
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+type attributeSpan struct {
+	trace.Span
+	provider *attributeTracerProvider
+}
+
+func (s attributeSpan) SetAttributes(kv ...attribute.KeyValue) {
+	s.provider.mu.Lock()
+	defer s.provider.mu.Unlock()
+	s.provider.attrs = append(s.provider.attrs, kv...)
+}
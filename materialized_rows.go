@@ -0,0 +1,15 @@
+package wsqlx
+
+import (
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/internal/staticrows"
+	"github.com/jmoiron/sqlx"
+)
+
+// materializedRows is a fully read result set. It is used to serve results
+// that did not come from the database, e.g. cached results, as *sqlx.Rows
+// with its Query and QueryRow methods.
+type materializedRows = staticrows.Rows
+
+func materializeRows(rows *sqlx.Rows) (*materializedRows, error) {
+	return staticrows.Read(rows.Rows)
+}
@@ -1,17 +1,63 @@
 package wsqlx
 
+import (
+	"errors"
+	"fmt"
+	"github.com/Masterminds/squirrel"
+	"github.com/lann/builder"
+	"strconv"
+)
+
 type PaginationInput struct {
-	Page     int64
-	PageSize int64
+	Page     int64 `json:"page"`
+	PageSize int64 `json:"page_size"`
 }
 
 type PaginationOutput struct {
-	Page      int64
-	PageSize  int64
-	PageCount int64
-	TotalData int64
+	Page      int64 `json:"page"`
+	PageSize  int64 `json:"page_size"`
+	PageCount int64 `json:"page_count"`
+	TotalData int64 `json:"total_data"`
+	// IsEstimate is set when TotalData and PageCount are based on an estimated
+	// count, see WithEstimatedCount.
+	IsEstimate  bool `json:"is_estimate"`
+	HasNext     bool `json:"has_next"`
+	HasPrevious bool `json:"has_previous"`
+	// FirstItemIndex and LastItemIndex are the 1-based positions of the first
+	// and the last item of the page within all data, both are 0 for an empty page.
+	FirstItemIndex int64 `json:"first_item_index"`
+	LastItemIndex  int64 `json:"last_item_index"`
+	// OutOfRange is set when Page is beyond the last page.
+	OutOfRange bool `json:"out_of_range"`
+}
+
+type PaginationNoCountOutput struct {
+	Page        int64 `json:"page"`
+	PageSize    int64 `json:"page_size"`
+	HasNext     bool  `json:"has_next"`
+	HasPrevious bool  `json:"has_previous"`
 }
 
+// OutOfRangeBehaviour defines what QuerySqPagination does when the requested
+// page is beyond the last page.
+type OutOfRangeBehaviour uint8
+
+const (
+	// OutOfRangeEmpty returns an empty page with OutOfRange set.
+	OutOfRangeEmpty OutOfRangeBehaviour = iota + 1
+	// OutOfRangeError returns ErrPageOutOfRange. The data query has already run
+	// by then, so the callback was called with no rows.
+	OutOfRangeError
+)
+
+// ErrPageOutOfRange is returned for pages beyond the last page when
+// OutOfRangeError is configured with WithOutOfRangeBehaviour.
+var ErrPageOutOfRange = errors.New("wsqlx: page is out of range")
+
+// ErrInvalidPageSize is returned by QuerySqPaginationNoCount for a PageSize
+// below 1.
+var ErrInvalidPageSize = errors.New("wsqlx: page size must be at least 1")
+
 func (p PaginationInput) Offset() int64 {
 	offset := int64(0)
 	if p.Page > 0 {
@@ -21,7 +67,13 @@ func (p PaginationInput) Offset() int64 {
 	return offset
 }
 
+// getPageCount returns 0 for an empty result set and 1 when pageSize is not
+// positive, in which case all data fits on a single page.
 func getPageCount(pageSize, totalData int64) int64 {
+	if totalData <= 0 {
+		return 0
+	}
+
 	pageCount := int64(1)
 	if pageSize > 0 {
 		if pageSize >= totalData {
@@ -40,10 +92,114 @@ func getPageCount(pageSize, totalData int64) int64 {
 
 func CreatePaginationOutput(input PaginationInput, totalData int64) PaginationOutput {
 	pageCount := getPageCount(input.PageSize, totalData)
-	return PaginationOutput{
-		Page:      input.Page,
-		PageSize:  input.PageSize,
-		TotalData: totalData,
-		PageCount: pageCount,
+
+	page := input.Page
+	if page < 1 {
+		page = 1
+	}
+
+	output := PaginationOutput{
+		Page:        input.Page,
+		PageSize:    input.PageSize,
+		TotalData:   totalData,
+		PageCount:   pageCount,
+		HasNext:     page < pageCount,
+		HasPrevious: page > 1,
+		OutOfRange:  page > max(pageCount, 1),
+	}
+
+	if offset := input.Offset(); offset < totalData {
+		output.FirstItemIndex = offset + 1
+		output.LastItemIndex = totalData
+		if input.PageSize > 0 {
+			output.LastItemIndex = min(offset+input.PageSize, totalData)
+		}
+	}
+
+	return output
+}
+
+func CreatePaginationNoCountOutput(input PaginationInput, hasNext bool) PaginationNoCountOutput {
+	return PaginationNoCountOutput{
+		Page:        input.Page,
+		PageSize:    input.PageSize,
+		HasNext:     hasNext,
+		HasPrevious: input.Page > 1,
+	}
+}
+
+// CountStrategy defines how QuerySqPaginationAuto derives the total count from
+// the data query.
+type CountStrategy uint8
+
+const (
+	// CountStrategySubquery counts the rows of the data query wrapped as a
+	// subquery: SELECT COUNT(*) FROM (query) AS wsqlx_count. It is correct for
+	// every query, including GROUP BY and DISTINCT.
+	CountStrategySubquery CountStrategy = iota + 1
+	// CountStrategyColumns replaces the columns of the data query by COUNT(*).
+	// It avoids the subquery but is wrong for GROUP BY and DISTINCT queries.
+	CountStrategyColumns
+	// CountStrategyWindow adds COUNT(*) OVER() to the data query, fetching the
+	// page and the total count in a single round trip. The database has to
+	// support window functions.
+	CountStrategyWindow
+)
+
+const windowCountColumn = "wsqlx_total_count"
+
+// deriveCountQuery builds the count query of query, which is stripped of its
+// ORDER BY, LIMIT and OFFSET clauses.
+func deriveCountQuery(query squirrel.SelectBuilder, strategy CountStrategy) squirrel.SelectBuilder {
+	query = builder.Delete(query, "OrderByParts").(squirrel.SelectBuilder)
+	query = query.RemoveLimit().RemoveOffset()
+
+	if strategy == CountStrategyColumns {
+		return query.RemoveColumns().Column("COUNT(*)")
+	}
+
+	countQuery := squirrel.Select("COUNT(*)").FromSelect(query, "wsqlx_count")
+	if format, ok := builder.Get(query, "PlaceholderFormat"); ok {
+		countQuery = countQuery.PlaceholderFormat(format.(squirrel.PlaceholderFormat))
+	}
+
+	return countQuery
+}
+
+// splitWindowCount removes the trailing COUNT(*) OVER() column from rows and
+// returns its value.
+func splitWindowCount(rows *materializedRows) (int64, error) {
+	last := len(rows.Columns) - 1
+	if last < 0 || rows.Columns[last] != windowCountColumn {
+		return 0, fmt.Errorf("wsqlx: missing %s column", windowCountColumn)
+	}
+
+	totalData := int64(0)
+	for i, values := range rows.Values {
+		if i == 0 {
+			var err error
+			if totalData, err = toInt64(values[last]); err != nil {
+				return 0, err
+			}
+		}
+		rows.Values[i] = values[:last]
+	}
+	rows.Columns = rows.Columns[:last]
+
+	return totalData, nil
+}
+
+func toInt64(value any) (int64, error) {
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("wsqlx: cannot convert %T to int64", value)
 	}
 }
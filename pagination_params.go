@@ -0,0 +1,171 @@
+package wsqlx
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+)
+
+// PaginationParamsConfig defines the bounds and the whitelisted fields used by
+// ParsePaginationParams. Public field names are mapped to SQL columns, so only
+// columns listed here can ever reach the query.
+type PaginationParamsConfig struct {
+	// DefaultPageSize is used when page_size is missing, 10 when zero.
+	DefaultPageSize int64
+	// MaxPageSize bounds page_size, which is unbounded when zero.
+	MaxPageSize int64
+	// SortFields maps the names accepted in the sort parameter to SQL columns.
+	SortFields map[string]string
+	// FilterFields maps the names accepted as filter[name] to SQL columns.
+	FilterFields map[string]string
+	// DefaultSort is used when the request has no sort parameter.
+	DefaultSort []SortField
+}
+
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+type FilterField struct {
+	Column string
+	Values []string
+}
+
+type PaginationParams struct {
+	Pagination PaginationInput
+	Sort       []SortField
+	Filters    []FilterField
+}
+
+// ParamError is returned by ParsePaginationParams for an invalid parameter.
+type ParamError struct {
+	Param  string
+	Reason string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("wsqlx: invalid parameter %q: %s", e.Param, e.Reason)
+}
+
+// defaultPageSizeFallback is used by Clamp when its defaultPageSize is not
+// positive.
+const defaultPageSizeFallback = 10
+
+// Clamp returns p with PageSize between 1 and maxPageSize, using
+// defaultPageSize, or 10 when it is not positive either, when PageSize is not
+// positive. A zero maxPageSize leaves PageSize unbounded. Page is kept between 1
+// and the last page whose Offset fits in an int64.
+func (p PaginationInput) Clamp(defaultPageSize, maxPageSize int64) PaginationInput {
+	if p.PageSize < 1 {
+		p.PageSize = defaultPageSize
+	}
+	if p.PageSize < 1 {
+		p.PageSize = defaultPageSizeFallback
+	}
+	if maxPageSize > 0 && p.PageSize > maxPageSize {
+		p.PageSize = maxPageSize
+	}
+
+	if p.Page < 1 {
+		p.Page = 1
+	}
+	if maxPages := math.MaxInt64 / p.PageSize; p.Page-1 > maxPages {
+		p.Page = maxPages + 1
+	}
+
+	return p
+}
+
+// ParsePaginationParams parses the page, page_size, sort and filter[name] query
+// parameters. sort is a comma separated list of field names, a leading '-'
+// sorts descending: sort=-created_at,name. Repeating a filter, e.g.
+// filter[status]=new&filter[status]=paid, matches any of the values.
+func ParsePaginationParams(values url.Values, config PaginationParamsConfig) (PaginationParams, error) {
+	params := PaginationParams{}
+
+	var err error
+	if page := values.Get("page"); page != "" {
+		if params.Pagination.Page, err = strconv.ParseInt(page, 10, 64); err != nil {
+			return PaginationParams{}, &ParamError{Param: "page", Reason: "must be an integer"}
+		}
+	}
+	if pageSize := values.Get("page_size"); pageSize != "" {
+		if params.Pagination.PageSize, err = strconv.ParseInt(pageSize, 10, 64); err != nil {
+			return PaginationParams{}, &ParamError{Param: "page_size", Reason: "must be an integer"}
+		}
+	}
+	params.Pagination = params.Pagination.Clamp(config.DefaultPageSize, config.MaxPageSize)
+
+	params.Sort = config.DefaultSort
+	if sortParam := values.Get("sort"); sortParam != "" {
+		params.Sort = make([]SortField, 0)
+		for _, field := range strings.Split(sortParam, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			column, ok := config.SortFields[strings.TrimPrefix(field, "-")]
+			if !ok {
+				return PaginationParams{}, &ParamError{Param: "sort", Reason: fmt.Sprintf("unknown field %q", field)}
+			}
+			params.Sort = append(params.Sort, SortField{Column: column, Desc: desc})
+		}
+	}
+
+	// Iterate in a stable order, so the same request always builds the same SQL.
+	filterParams := make([]string, 0)
+	for param := range values {
+		if strings.HasPrefix(param, "filter[") && strings.HasSuffix(param, "]") {
+			filterParams = append(filterParams, param)
+		}
+	}
+	sort.Strings(filterParams)
+
+	params.Filters = make([]FilterField, 0, len(filterParams))
+	for _, param := range filterParams {
+		name := strings.TrimSuffix(strings.TrimPrefix(param, "filter["), "]")
+		column, ok := config.FilterFields[name]
+		if !ok {
+			return PaginationParams{}, &ParamError{Param: param, Reason: fmt.Sprintf("unknown field %q", name)}
+		}
+		params.Filters = append(params.Filters, FilterField{Column: column, Values: values[param]})
+	}
+
+	return params, nil
+}
+
+// ApplyFilters adds the filters to the WHERE clause of query as bound
+// arguments. Apply it to both the data and the count query.
+func (p PaginationParams) ApplyFilters(query squirrel.SelectBuilder) squirrel.SelectBuilder {
+	for _, filter := range p.Filters {
+		if len(filter.Values) == 1 {
+			query = query.Where(squirrel.Eq{filter.Column: filter.Values[0]})
+		} else {
+			query = query.Where(squirrel.Eq{filter.Column: filter.Values})
+		}
+	}
+
+	return query
+}
+
+// ApplySort adds the sort fields to the ORDER BY clause of query.
+func (p PaginationParams) ApplySort(query squirrel.SelectBuilder) squirrel.SelectBuilder {
+	for _, field := range p.Sort {
+		if field.Desc {
+			query = query.OrderBy(field.Column + " DESC")
+		} else {
+			query = query.OrderBy(field.Column + " ASC")
+		}
+	}
+
+	return query
+}
+
+// Apply applies both the filters and the sort fields to query.
+func (p PaginationParams) Apply(query squirrel.SelectBuilder) squirrel.SelectBuilder {
+	return p.ApplySort(p.ApplyFilters(query))
+}
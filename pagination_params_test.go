@@ -0,0 +1,53 @@
+package wsqlx_test
+
+import (
+	"math"
+	"net/url"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ParsePaginationParams(t *testing.T) {
+	config := wsqlx.PaginationParamsConfig{
+		DefaultPageSize: 20,
+		MaxPageSize:     100,
+		SortFields:      map[string]string{"name": "u.name", "created_at": "u.created_at"},
+		FilterFields:    map[string]string{"status": "u.status"},
+	}
+
+	t.Run("should clamp pagination and apply sort and filter", func(t *testing.T) {
+		values, err := url.ParseQuery("page=-3&page_size=1000000000&sort=-created_at,name&filter[status]=new&filter[status]=paid")
+		require.NoError(t, err)
+
+		params, err := wsqlx.ParsePaginationParams(values, config)
+		require.NoError(t, err)
+		require.Equal(t, wsqlx.PaginationInput{Page: 1, PageSize: 100}, params.Pagination)
+
+		rawQuery, args, err := params.Apply(squirrel.Select("u.id").From("users u")).ToSql()
+		require.NoError(t, err)
+		require.Equal(t, "SELECT u.id FROM users u WHERE u.status IN (?,?) ORDER BY u.created_at DESC, u.name ASC", rawQuery)
+		require.Equal(t, []interface{}{"new", "paid"}, args)
+	})
+
+	t.Run("should default the page size and bound the page", func(t *testing.T) {
+		input := wsqlx.PaginationInput{Page: math.MaxInt64, PageSize: 0}.Clamp(0, 0)
+		require.Equal(t, int64(10), input.PageSize)
+		require.Positive(t, input.Offset())
+		require.Equal(t, int64(math.MaxInt64/10*10), input.Offset())
+
+		input = wsqlx.PaginationInput{Page: math.MaxInt64, PageSize: 1}.Clamp(20, 0)
+		require.Equal(t, int64(math.MaxInt64-1), input.Offset())
+	})
+
+	t.Run("should reject sort field outside the whitelist", func(t *testing.T) {
+		values := url.Values{"sort": []string{"password; DROP TABLE users"}}
+
+		_, err := wsqlx.ParsePaginationParams(values, config)
+		var paramErr *wsqlx.ParamError
+		require.ErrorAs(t, err, &paramErr)
+		require.Equal(t, "sort", paramErr.Param)
+	})
+}
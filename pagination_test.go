@@ -0,0 +1,472 @@
+package wsqlx_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rdbms_QuerySqPagination(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+	mock.MatchExpectationsInOrder(false)
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithConcurrentPagination())
+
+	t.Run("should return pagination output with concurrent count", func(t *testing.T) {
+		query := squirrel.Select("id").From("users")
+		countQuery := squirrel.Select("COUNT(*)").From("users")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users LIMIT 2 OFFSET 0`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+		ids := make([]int, 0)
+		output, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 2},
+			func(rows *sqlx.Rows) (err error) {
+				for rows.Next() {
+					var id int
+					require.NoError(t, rows.Scan(&id))
+					ids = append(ids, id)
+				}
+				return nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, []int{1, 2}, ids)
+		require.Equal(t, int64(3), output.TotalData)
+		require.Equal(t, int64(2), output.PageCount)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run count and data query sequentially inside a transaction", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithConcurrentPagination())
+
+		query := squirrel.Select("id").From("users")
+		countQuery := squirrel.Select("COUNT(*)").From("users")
+
+		// The delayed count would let a concurrent data query jump ahead of it
+		// and break the expected order.
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM users`)).
+			WillDelayFor(20 * time.Millisecond).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users LIMIT 2 OFFSET 0`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+		mock.ExpectCommit()
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			output, err := tx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 2},
+				func(rows *sqlx.Rows) (err error) {
+					return nil
+				})
+			require.Equal(t, int64(1), output.TotalData)
+			return err
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should cancel the data query when the count fails", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+		mock.MatchExpectationsInOrder(false)
+		sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithConcurrentPagination())
+
+		query := squirrel.Select("id").From("users")
+		countQuery := squirrel.Select("COUNT(*)").From("users")
+		errCount := errors.New("count failed")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM users`)).
+			WillReturnError(errCount)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users LIMIT 2 OFFSET 0`)).
+			WillDelayFor(time.Minute).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		start := time.Now()
+		_, err = sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 2},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.ErrorIs(t, err, errCount)
+		require.Less(t, time.Since(start), 10*time.Second)
+	})
+}
+
+func Test_rdbms_QuerySqPaginationAuto(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	sqlxx := wsqlx.NewRdbms(sqlxDB)
+	query := squirrel.Select("id").From("users").Where(squirrel.Eq{"active": true}).OrderBy("id DESC")
+
+	scanIDs := func(ids *[]int) func(rows *sqlx.Rows) error {
+		return func(rows *sqlx.Rows) (err error) {
+			for rows.Next() {
+				var id int
+				require.NoError(t, rows.Scan(&id))
+				*ids = append(*ids, id)
+			}
+			return nil
+		}
+	}
+
+	t.Run("should derive count query as subquery", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM (SELECT id FROM users WHERE active = ?) AS wsqlx_count`)).
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE active = ? ORDER BY id DESC LIMIT 2 OFFSET 0`)).
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(2))
+
+		ids := make([]int, 0)
+		output, err := sqlxx.QuerySqPaginationAuto(ctx, query, wsqlx.PaginationInput{Page: 1, PageSize: 2},
+			wsqlx.CountStrategySubquery, scanIDs(&ids))
+		require.NoError(t, err)
+		require.Equal(t, []int{3, 2}, ids)
+		require.Equal(t, int64(3), output.TotalData)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should read total count from window function", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, COUNT(*) OVER() AS wsqlx_total_count FROM users WHERE active = ? ORDER BY id DESC LIMIT 2 OFFSET 2`)).
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "wsqlx_total_count"}).AddRow(1, 3))
+
+		ids := make([]int, 0)
+		output, err := sqlxx.QuerySqPaginationAuto(ctx, query, wsqlx.PaginationInput{Page: 2, PageSize: 2},
+			wsqlx.CountStrategyWindow, scanIDs(&ids))
+		require.NoError(t, err)
+		require.Equal(t, []int{1}, ids)
+		require.Equal(t, int64(3), output.TotalData)
+		require.Equal(t, int64(2), output.PageCount)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_rdbms_QuerySqPagination_OutOfRangeError(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithOutOfRangeBehaviour(wsqlx.OutOfRangeError))
+	query := squirrel.Select("id").From("users")
+
+	t.Run("should return ErrPageOutOfRange after calling back with no rows", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users LIMIT 2 OFFSET 4`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		called := false
+		output, err := sqlxx.QuerySqPagination(ctx, squirrel.Select("COUNT(*)").From("users"), query,
+			wsqlx.PaginationInput{Page: 3, PageSize: 2}, func(rows *sqlx.Rows) error {
+				called = true
+				require.False(t, rows.Next())
+				return nil
+			})
+		require.ErrorIs(t, err, wsqlx.ErrPageOutOfRange)
+		require.Equal(t, wsqlx.PaginationOutput{}, output)
+		require.True(t, called)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return ErrPageOutOfRange from the window count", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id, COUNT(*) OVER() AS wsqlx_total_count FROM users LIMIT 2 OFFSET 4`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "wsqlx_total_count"}))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM (SELECT id FROM users) AS wsqlx_count`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+
+		_, err := sqlxx.QuerySqPaginationAuto(ctx, query, wsqlx.PaginationInput{Page: 3, PageSize: 2},
+			wsqlx.CountStrategyWindow, func(rows *sqlx.Rows) error {
+				return nil
+			})
+		require.ErrorIs(t, err, wsqlx.ErrPageOutOfRange)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return the last page", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM (SELECT id FROM users) AS wsqlx_count`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users LIMIT 2 OFFSET 2`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+
+		output, err := sqlxx.QuerySqPaginationAuto(ctx, query, wsqlx.PaginationInput{Page: 2, PageSize: 2},
+			wsqlx.CountStrategySubquery, func(rows *sqlx.Rows) error {
+				return nil
+			})
+		require.NoError(t, err)
+		require.False(t, output.OutOfRange)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_rdbms_QuerySqPaginationNoCount(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	sqlxx := wsqlx.NewRdbms(sqlxDB)
+	query := squirrel.Select("id").From("users").Where(squirrel.Eq{"active": true}).OrderBy("id DESC")
+
+	t.Run("should probe next page without counting", func(t *testing.T) {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE active = ? ORDER BY id DESC LIMIT 3 OFFSET 2`)).
+			WithArgs(true).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5).AddRow(4).AddRow(3))
+
+		ids := make([]int, 0)
+		output, err := sqlxx.QuerySqPaginationNoCount(ctx, query, wsqlx.PaginationInput{Page: 2, PageSize: 2}, func(rows *sqlx.Rows) (err error) {
+			for rows.Next() {
+				var id int
+				require.NoError(t, rows.Scan(&id))
+				ids = append(ids, id)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int{5, 4}, ids)
+		require.True(t, output.HasNext)
+		require.True(t, output.HasPrevious)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should reject a page size below 1", func(t *testing.T) {
+		for _, pageSize := range []int64{0, -2} {
+			_, err := sqlxx.QuerySqPaginationNoCount(ctx, query, wsqlx.PaginationInput{Page: 1, PageSize: pageSize}, func(rows *sqlx.Rows) error {
+				return nil
+			})
+			require.ErrorIs(t, err, wsqlx.ErrInvalidPageSize)
+		}
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_rdbms_QuerySqPagination_EstimatedCount(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithDialect(wsqlx.DialectPostgres), wsqlx.WithEstimatedCount(1000))
+
+	t.Run("should use estimated count above the threshold", func(t *testing.T) {
+		query := squirrel.Select("id").From("events")
+		countQuery := squirrel.Select("COUNT(*)").From("events")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`EXPLAIN (FORMAT JSON) SELECT id FROM events`)).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Plan Rows": 500000000}}]`))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM events LIMIT 10 OFFSET 0`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		output, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 10},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.NoError(t, err)
+		require.True(t, output.IsEstimate)
+		require.Equal(t, int64(500000000), output.TotalData)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should reuse the estimate for the next page", func(t *testing.T) {
+		query := squirrel.Select("id").From("events")
+		countQuery := squirrel.Select("COUNT(*)").From("events")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM events LIMIT 10 OFFSET 10`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+
+		output, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 2, PageSize: 10},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.NoError(t, err)
+		require.True(t, output.IsEstimate)
+		require.Equal(t, int64(500000000), output.TotalData)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should fall back to the exact count when the estimate fails", func(t *testing.T) {
+		query := squirrel.Select("id").From("logs")
+		countQuery := squirrel.Select("COUNT(*)").From("logs")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`EXPLAIN (FORMAT JSON) SELECT id FROM logs`)).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`not json`))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM logs`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM logs LIMIT 10 OFFSET 0`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		output, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 10},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.NoError(t, err)
+		require.False(t, output.IsEstimate)
+		require.Equal(t, int64(3), output.TotalData)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should apply the out of range behaviour to the estimate", func(t *testing.T) {
+		sqlxx := sqlxx.Derive(wsqlx.WithOutOfRangeBehaviour(wsqlx.OutOfRangeError))
+		query := squirrel.Select("id").From("metrics")
+		countQuery := squirrel.Select("COUNT(*)").From("metrics")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`EXPLAIN (FORMAT JSON) SELECT id FROM metrics`)).
+			WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Plan Rows": 5000}}]`))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM metrics LIMIT 10 OFFSET 10000`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		_, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1001, PageSize: 10},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.ErrorIs(t, err, wsqlx.ErrPageOutOfRange)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_rdbms_QuerySqPagination_EstimatedCount_MySQL(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithDialect(wsqlx.DialectMySQL), wsqlx.WithEstimatedCount(1000))
+
+	t.Run("should estimate from the table statistics of an unfiltered query", func(t *testing.T) {
+		query := squirrel.Select("id").From("events")
+		countQuery := squirrel.Select("COUNT(*)").From("events")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT TABLE_ROWS FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?`)).
+			WithArgs("events").
+			WillReturnRows(sqlmock.NewRows([]string{"TABLE_ROWS"}).AddRow(2000000))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM events LIMIT 10 OFFSET 0`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		output, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 10},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.NoError(t, err)
+		require.True(t, output.IsEstimate)
+		require.Equal(t, int64(2000000), output.TotalData)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run the exact count of a query with a WHERE", func(t *testing.T) {
+		query := squirrel.Select("id").From("events").Where(squirrel.Eq{"user_id": 7})
+		countQuery := squirrel.Select("COUNT(*)").From("events").Where(squirrel.Eq{"user_id": 7})
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM events WHERE user_id = ?`)).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM events WHERE user_id = ? LIMIT 10 OFFSET 0`)).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		output, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 10},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.NoError(t, err)
+		require.False(t, output.IsEstimate)
+		require.Equal(t, int64(3), output.TotalData)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run the exact count of a query with a JOIN", func(t *testing.T) {
+		query := squirrel.Select("e.id").From("events e").Join("users u ON u.id = e.user_id")
+		countQuery := squirrel.Select("COUNT(*)").From("events e").Join("users u ON u.id = e.user_id")
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM events e JOIN users u ON u.id = e.user_id`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT e.id FROM events e JOIN users u ON u.id = e.user_id LIMIT 10 OFFSET 0`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		output, err := sqlxx.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: 1, PageSize: 10},
+			func(rows *sqlx.Rows) (err error) {
+				return nil
+			})
+		require.NoError(t, err)
+		require.False(t, output.IsEstimate)
+		require.Equal(t, int64(5), output.TotalData)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_CreatePaginationOutput(t *testing.T) {
+	t.Run("should fill navigation metadata", func(t *testing.T) {
+		output := wsqlx.CreatePaginationOutput(wsqlx.PaginationInput{Page: 2, PageSize: 10}, 25)
+		require.Equal(t, wsqlx.PaginationOutput{
+			Page:           2,
+			PageSize:       10,
+			PageCount:      3,
+			TotalData:      25,
+			HasNext:        true,
+			HasPrevious:    true,
+			FirstItemIndex: 11,
+			LastItemIndex:  20,
+		}, output)
+	})
+
+	t.Run("should have no page for empty result", func(t *testing.T) {
+		output := wsqlx.CreatePaginationOutput(wsqlx.PaginationInput{Page: 1, PageSize: 10}, 0)
+		require.Equal(t, int64(0), output.PageCount)
+		require.False(t, output.OutOfRange)
+		require.Equal(t, int64(0), output.FirstItemIndex)
+	})
+
+	t.Run("should mark page beyond the last one as out of range", func(t *testing.T) {
+		output := wsqlx.CreatePaginationOutput(wsqlx.PaginationInput{Page: 4, PageSize: 10}, 25)
+		require.True(t, output.OutOfRange)
+		require.False(t, output.HasNext)
+		require.Equal(t, int64(0), output.LastItemIndex)
+	})
+}
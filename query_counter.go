@@ -0,0 +1,200 @@
+package wsqlx
+
+import (
+	"context"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/internal/sqltext"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	stringLiteralRegex = regexp.MustCompile(`'(?:[^']|'')*'`)
+	numberLiteralRegex = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	inListRegex        = regexp.MustCompile(`(?i)\bIN \(\?(?:, ?\?)*\)`)
+	valuesListRegex    = regexp.MustCompile(`(?i)\bVALUES \([^)]*\)(?:, ?\([^)]*\))*`)
+)
+
+// SQLFingerprint returns stmt with its formatting, literals and placeholders
+// normalized, so statements that only differ in their arguments share the same
+// fingerprint: SELECT * FROM users WHERE id IN ($1, $2) becomes
+// SELECT * FROM users WHERE id IN (?).
+func SQLFingerprint(stmt string) string {
+	stmt = normalizeSQL(stmt)
+	stmt = stringLiteralRegex.ReplaceAllString(stmt, "?")
+	stmt = sqltext.NumberedPlaceholderRegex.ReplaceAllString(stmt, "?")
+	stmt = numberLiteralRegex.ReplaceAllString(stmt, "?")
+	stmt = inListRegex.ReplaceAllString(stmt, "IN (?)")
+	stmt = valuesListRegex.ReplaceAllString(stmt, "VALUES (?)")
+	return strings.TrimSuffix(stmt, ";")
+}
+
+// QueryCounter counts statements grouped by SQLFingerprint. It is safe for
+// concurrent use.
+type QueryCounter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	total  int
+}
+
+func NewQueryCounter() *QueryCounter {
+	return &QueryCounter{counts: make(map[string]int)}
+}
+
+// Add counts stmt and returns how many times its fingerprint was counted.
+func (c *QueryCounter) Add(stmt string) int {
+	fingerprint := SQLFingerprint(stmt)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total++
+	c.counts[fingerprint]++
+	return c.counts[fingerprint]
+}
+
+// Total returns the number of counted statements.
+func (c *QueryCounter) Total() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Counts returns a copy of the counts by fingerprint.
+func (c *QueryCounter) Counts() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := make(map[string]int, len(c.counts))
+	for fingerprint, count := range c.counts {
+		counts[fingerprint] = count
+	}
+	return counts
+}
+
+func (c *QueryCounter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts = make(map[string]int)
+	c.total = 0
+}
+
+// String lists the counts, the most frequent fingerprint first.
+func (c *QueryCounter) String() string {
+	counts := c.Counts()
+	fingerprints := make([]string, 0, len(counts))
+	for fingerprint := range counts {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		if counts[fingerprints[i]] != counts[fingerprints[j]] {
+			return counts[fingerprints[i]] > counts[fingerprints[j]]
+		}
+		return fingerprints[i] < fingerprints[j]
+	})
+
+	b := strings.Builder{}
+	for _, fingerprint := range fingerprints {
+		b.WriteString(strconv.Itoa(counts[fingerprint]))
+		b.WriteString("x ")
+		b.WriteString(fingerprint)
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+type queryCounterKey struct{}
+
+// queryCounterScope is a counter added to a context, linked to the counters
+// added to its parent contexts.
+type queryCounterScope struct {
+	counter *QueryCounter
+	// request is set for the scopes started by ContextWithQueryCounter, the
+	// ones QueryCounterFromContext and N+1 detection refer to.
+	request bool
+	parent  *queryCounterScope
+}
+
+// ContextWithQueryCounter starts a scope, typically one request, in which rdbms
+// counts the executed statements. WithNPlusOneDetection reports the
+// fingerprints repeated within the scope.
+func ContextWithQueryCounter(ctx context.Context) context.Context {
+	return contextWithQueryCounter(ctx, NewQueryCounter(), true)
+}
+
+// ContextWithQueryCounterOf makes rdbms also count the statements executed with
+// the returned context into counter, e.g. to count the statements of a test
+// across calls. It doesn't start a scope for QueryCounterFromContext and N+1
+// detection.
+func ContextWithQueryCounterOf(ctx context.Context, counter *QueryCounter) context.Context {
+	return contextWithQueryCounter(ctx, counter, false)
+}
+
+func contextWithQueryCounter(ctx context.Context, counter *QueryCounter, request bool) context.Context {
+	parent, _ := ctx.Value(queryCounterKey{}).(*queryCounterScope)
+	for scope := parent; scope != nil; scope = scope.parent {
+		if scope.counter == counter {
+			return ctx
+		}
+	}
+	return context.WithValue(ctx, queryCounterKey{}, &queryCounterScope{counter: counter, request: request, parent: parent})
+}
+
+// QueryCounterFromContext returns the counter of the scope started by
+// ContextWithQueryCounter.
+func QueryCounterFromContext(ctx context.Context) (*QueryCounter, bool) {
+	scope, _ := ctx.Value(queryCounterKey{}).(*queryCounterScope)
+	for ; scope != nil; scope = scope.parent {
+		if scope.request {
+			return scope.counter, true
+		}
+	}
+	return nil, false
+}
+
+type nPlusOneDetection struct {
+	threshold int
+	logger    *slog.Logger
+}
+
+// WithNPlusOneDetection warns, with a log record and a db.n_plus_one span event,
+// when the same fingerprint runs more than threshold times within a context
+// started by ContextWithQueryCounter. slog.Default is used when logger is nil.
+func WithNPlusOneDetection(threshold int, logger *slog.Logger) optionFunc {
+	return func(cfg *rdbms) {
+		if logger == nil {
+			logger = slog.Default()
+		}
+		cfg.nPlusOne = &nPlusOneDetection{threshold: threshold, logger: logger}
+	}
+}
+
+// countQuery adds rawQuery to the counters of ctx, if any, and warns once per
+// fingerprint when it crosses the N+1 threshold of the request scope.
+func (s *rdbms) countQuery(ctx context.Context, rawQuery string) {
+	count := 0
+	scope, _ := ctx.Value(queryCounterKey{}).(*queryCounterScope)
+	for ; scope != nil; scope = scope.parent {
+		n := scope.counter.Add(rawQuery)
+		if scope.request && count == 0 {
+			count = n
+		}
+	}
+
+	if s.nPlusOne == nil || count != s.nPlusOne.threshold+1 {
+		return
+	}
+
+	fingerprint := SQLFingerprint(rawQuery)
+	s.nPlusOne.logger.WarnContext(ctx, "wsqlx possible N+1 query",
+		slog.String("fingerprint", fingerprint), slog.Int("threshold", s.nPlusOne.threshold))
+	trace.SpanFromContext(ctx).AddEvent("db.n_plus_one", trace.WithAttributes(
+		attribute.String("db.query.fingerprint", fingerprint),
+		attribute.Int("db.n_plus_one.threshold", s.nPlusOne.threshold),
+	))
+}
@@ -0,0 +1,87 @@
+package wsqlx_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SQLFingerprint(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE id = $1":                    "SELECT * FROM users WHERE id = ?",
+		"SELECT * FROM users\n\tWHERE id IN (?, ?, ?)":         "SELECT * FROM users WHERE id IN (?)",
+		"SELECT * FROM users WHERE name = 'iban' AND age > 20": "SELECT * FROM users WHERE name = ? AND age > ?",
+		"INSERT INTO users (name) VALUES (?),(?) RETURNING id": "INSERT INTO users (name) VALUES (?) RETURNING id",
+	}
+	for stmt, want := range tests {
+		require.Equal(t, want, wsqlx.SQLFingerprint(stmt))
+	}
+}
+
+func Test_rdbms_NPlusOneDetection(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	logs := &bytes.Buffer{}
+	sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"),
+		wsqlx.WithNPlusOneDetection(2, slog.New(slog.NewTextHandler(logs, nil))))
+
+	ctx := wsqlx.ContextWithQueryCounter(context.TODO())
+	for id := 1; id <= 4; id++ {
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT name FROM users WHERE id = ?`)).
+			WithArgs(id).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("iban"))
+
+		var name string
+		err = sqlxx.QueryRowSq(ctx, squirrel.Select("name").From("users").Where(squirrel.Eq{"id": id}),
+			wsqlx.QueryRowScanTypeDefault, &name)
+		require.NoError(t, err)
+	}
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	counter, ok := wsqlx.QueryCounterFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, 4, counter.Total())
+	require.Equal(t, map[string]int{"SELECT name FROM users WHERE id = ?": 4}, counter.Counts())
+
+	require.Equal(t, 1, strings.Count(logs.String(), "possible N+1 query"))
+}
+
+func Test_ContextWithQueryCounterOf(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"))
+	counter := wsqlx.NewQueryCounter()
+
+	ctx := wsqlx.ContextWithQueryCounter(context.TODO())
+	ctx = wsqlx.ContextWithQueryCounterOf(ctx, counter)
+	ctx = wsqlx.ContextWithQueryCounterOf(ctx, counter)
+
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = ?`)).
+		WithArgs(1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = sqlxx.ExecSq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, 1, counter.Total())
+	requestCounter, ok := wsqlx.QueryCounterFromContext(ctx)
+	require.True(t, ok)
+	require.NotSame(t, counter, requestCounter)
+	require.Equal(t, 1, requestCounter.Total())
+
+	_, ok = wsqlx.QueryCounterFromContext(wsqlx.ContextWithQueryCounterOf(context.TODO(), counter))
+	require.False(t, ok)
+}
@@ -16,9 +16,15 @@ type WriterCommand interface {
 	ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error)
 }
 
+// ReadQuery is the read side of Rdbms. QuerySqPaginationAuto and
+// QuerySqPaginationNoCount were added after v1.241102.0050, which breaks
+// implementations outside this package: they have to add them when upgrading.
+// The generated mocks already implement them.
 type ReadQuery interface {
 	QuerySq(ctx context.Context, query squirrel.Sqlizer, callback callbackRows) error
 	QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination PaginationInput, callback callbackRows) (PaginationOutput, error)
+	QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination PaginationInput, strategy CountStrategy, callback callbackRows) (PaginationOutput, error)
+	QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination PaginationInput, callback callbackRows) (PaginationNoCountOutput, error)
 	QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType QueryRowScanType, dest interface{}) error
 }
 
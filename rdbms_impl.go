@@ -9,10 +9,13 @@ import (
 	"github.com/jmoiron/sqlx"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
 	"runtime/debug"
 	"strings"
+	"sync"
 )
 
 // SpanNameFunc is a function that can be used to generate a span name for a
@@ -20,6 +23,10 @@ import (
 type SpanNameFunc func(stmt string) string
 type optionFunc func(*rdbms)
 
+// Option configures the rdbms returned by NewRdbms, see the With functions. It
+// lets other packages take options and pass them on to NewRdbms.
+type Option = optionFunc
+
 func WithAttributes(attrs ...attribute.KeyValue) optionFunc {
 	return func(cfg *rdbms) {
 		cfg.attrs = append(cfg.attrs, attrs...)
@@ -37,6 +44,30 @@ func WithSpanNameFunc(fn SpanNameFunc) optionFunc {
 	}
 }
 
+// WithMeterProvider sets the meter provider used for the metrics recorded by
+// rdbms. The global meter provider is used by default.
+func WithMeterProvider(mp metric.MeterProvider) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.meterProvider = mp
+	}
+}
+
+// WithConcurrentPagination runs the count and the data query of
+// QuerySqPagination concurrently outside transactions.
+func WithConcurrentPagination() optionFunc {
+	return func(cfg *rdbms) {
+		cfg.concurrentPagination = true
+	}
+}
+
+// WithOutOfRangeBehaviour defines what the paginated queries return for a page
+// beyond the last page. OutOfRangeEmpty is the default.
+func WithOutOfRangeBehaviour(behaviour OutOfRangeBehaviour) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.outOfRangeBehaviour = behaviour
+	}
+}
+
 func WithOutIncludeQueryParameters() optionFunc {
 	return func(cfg *rdbms) {
 		cfg.includeParams = false
@@ -80,29 +111,87 @@ func NewRdbms(db *sqlx.DB, opt ...optionFunc) *rdbms {
 		queryExecutor:  db,
 		tracer:         tp.Tracer(TracerName, trace.WithInstrumentationVersion(findOwnImportedVersion())),
 		tracerProvider: tp,
+		meterProvider:  otel.GetMeterProvider(),
 		attrs:          nil,
 		spanNameFunc:   defaultSpanNameFN,
 		includeParams:  true,
 		rdbmsConfig:    nil,
+
+		outOfRangeBehaviour: OutOfRangeEmpty,
+	}
+
+	if db != nil {
+		r.dialect = detectDialect(db.DriverName())
 	}
 
 	for _, o := range opt {
 		o(r)
 	}
 
+	if r.circuitBreakerConfig != nil {
+		r.circuitBreakerMetrics = newCircuitBreakerMetrics(r.meter())
+		r.circuitBreaker = r.circuitBreakerMetrics.newCircuitBreaker(*r.circuitBreakerConfig)
+	}
+
 	return r
 }
 
+// Derive returns a copy of the rdbms sharing its connection pool, with opt
+// applied on top of its configuration. Passing WithLimiter gives the copy its
+// own concurrency limit, otherwise the limiter is shared with the original.
+func (s *rdbms) Derive(opt ...optionFunc) *rdbms {
+	r := *s
+	for _, o := range opt {
+		o(&r)
+	}
+
+	if r.circuitBreakerConfig != s.circuitBreakerConfig {
+		if r.circuitBreakerMetrics == nil {
+			r.circuitBreakerMetrics = newCircuitBreakerMetrics(r.meter())
+		}
+		r.circuitBreaker = r.circuitBreakerMetrics.newCircuitBreaker(*r.circuitBreakerConfig)
+	}
+
+	return &r
+}
+
+func (s *rdbms) meter() metric.Meter {
+	return s.meterProvider.Meter(TracerName, metric.WithInstrumentationVersion(findOwnImportedVersion()))
+}
+
 type rdbms struct {
 	db            *sqlx.DB
 	queryExecutor queryExecutor
 
 	tracer         trace.Tracer
 	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
 	attrs          []attribute.KeyValue
 	spanNameFunc   SpanNameFunc
 	includeParams  bool
 	rdbmsConfig    *rdbmsConfig
+	cache          Cache
+	retryPolicy    *RetryPolicy
+	limiter        *Limiter
+	nPlusOne       *nPlusOneDetection
+
+	unboundedWriteGuard bool
+	readOnly            *ReadOnlyConfig
+	audit               *AuditConfig
+	tenant              *TenantConfig
+
+	concurrentPagination bool
+	estimateThreshold    int64
+	estimates            *memoryCache
+	outOfRangeBehaviour  OutOfRangeBehaviour
+	dialect              Dialect
+
+	circuitBreakerConfig  *CircuitBreakerConfig
+	circuitBreaker        *circuitBreaker
+	circuitBreakerMetrics *circuitBreakerMetrics
+
+	// tx is set when the rdbms is bound to a transaction.
+	tx *txState
 }
 
 type rdbmsConfig struct {
@@ -130,7 +219,7 @@ func (s *rdbms) sqlOperationName(stmt string) string {
 
 // commonAttribute returns a slice of SpanStartOptions that contain
 // attributes from the given connection config and common attribute like query text or query param
-func (s *rdbms) commonAttribute(rawQuery string, args ...interface{}) []trace.SpanStartOption {
+func (s *rdbms) commonAttribute(ctx context.Context, rawQuery string, args ...interface{}) []trace.SpanStartOption {
 	attrs := []trace.SpanStartOption{
 		trace.WithAttributes(semconv.DBOperationName(s.sqlOperationName(rawQuery))),
 		trace.WithSpanKind(trace.SpanKindClient),
@@ -151,20 +240,95 @@ func (s *rdbms) commonAttribute(rawQuery string, args ...interface{}) []trace.Sp
 	if s.attrs != nil {
 		attrs = append(attrs, trace.WithAttributes(s.attrs...))
 	}
+	if shardID, ok := shardIDFromContext(ctx); ok {
+		attrs = append(attrs, trace.WithAttributes(DBShardID.String(shardID)))
+	}
 
 	return attrs
 }
 
+// call runs fn against the database, applying the resilience policies
+// configured on rdbms: the retry policy around the circuit breaker.
+func (s *rdbms) call(ctx context.Context, idempotent bool, fn func() error) error {
+	return s.retry(ctx, idempotent, func() error {
+		if s.circuitBreaker == nil {
+			return fn()
+		}
+		return s.circuitBreaker.do(ctx, fn)
+	})
+}
+
+// guardStatement applies the statement policies configured on rdbms before the
+// statement reaches the database.
+func (s *rdbms) guardStatement(ctx context.Context, query squirrel.Sqlizer, rawQuery string) error {
+	if err := s.guardTenant(ctx); err != nil {
+		return err
+	}
+	if err := s.guardReadOnly(rawQuery); err != nil {
+		return err
+	}
+	return s.guardWrite(ctx, query, rawQuery)
+}
+
+// queryx and exec run the statement on the underlying executor through call.
+func (s *rdbms) queryx(ctx context.Context, rawQuery string, args []any) (res *sqlx.Rows, err error) {
+	s.countQuery(ctx, rawQuery)
+	err = s.call(ctx, cacheableStatement(rawQuery) || isIdempotent(ctx), func() error {
+		res, err = s.queryExecutor.QueryxContext(ctx, rawQuery, args...)
+		return err
+	})
+	return res, err
+}
+
+func (s *rdbms) exec(ctx context.Context, rawQuery string, args []any) (res sql.Result, err error) {
+	s.countQuery(ctx, rawQuery)
+	err = s.call(ctx, isIdempotent(ctx), func() error {
+		res, err = s.queryExecutor.ExecContext(ctx, rawQuery, args...)
+		return err
+	})
+	return res, err
+}
+
 func (s *rdbms) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback callbackRows) error {
 	rawQuery, args, err := query.ToSql()
 	if err != nil {
 		return errTracer(err)
 	}
+	if err = s.guardStatement(ctx, query, rawQuery); err != nil {
+		return errTracer(err)
+	}
+	if s.readOnlySession(ctx, rawQuery) || s.tenantInOwnTx(ctx) || s.auditInOwnTx(ctx, rawQuery) {
+		delivered := false
+		return s.doOwnTx(ctx, cacheableStatement(rawQuery) || isIdempotent(ctx), &delivered, func(ctx context.Context, tx Rdbms) error {
+			return tx.QuerySq(ctx, query, func(rows *sqlx.Rows) error {
+				delivered = true
+				return callback(rows)
+			})
+		})
+	}
 
-	ctx, spanQueryx := s.tracer.Start(ctx, s.spanNameFunc(rawQuery), s.commonAttribute(rawQuery, args)...)
+	ctx, spanQueryx := s.tracer.Start(ctx, s.spanNameFunc(rawQuery), s.commonAttribute(ctx, rawQuery, args)...)
 	defer spanQueryx.End()
 
-	res, err := s.queryExecutor.QueryxContext(ctx, rawQuery, args...)
+	if ttl, ok := s.cacheTTL(ctx, rawQuery); ok {
+		rows, hit, err := s.cachedRows(ctx, rawQuery, args, ttl)
+		if err != nil {
+			recordError(spanQueryx, err)
+			return err
+		}
+		spanQueryx.SetAttributes(DBCacheHit.Bool(hit))
+
+		return s.replayRows(ctx, rows, callback)
+	}
+
+	release, err := s.acquire(ctx)
+	if err != nil {
+		recordError(spanQueryx, err)
+		return err
+	}
+	defer release()
+
+	res, err := s.queryx(ctx, rawQuery, args)
 	if err != nil {
 		recordError(spanQueryx, err)
 		return err
@@ -177,6 +341,20 @@ func (s *rdbms) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback ca
 			spanQueryx.SetAttributes(attribute.String("db.system.close.rows", "successfully"))
 		}
 	}()
+	if !cacheableStatement(rawQuery) {
+		s.invalidateCache(ctx, rawQuery)
+	}
+
+	// A write with a RETURNING clause is read first to audit its returned rows.
+	if s.audited(ctx, rawQuery) {
+		rows, err := materializeRows(res)
+		if err != nil {
+			recordError(spanQueryx, err)
+			return err
+		}
+		s.recordAudit(ctx, rawQuery, args, int64(len(rows.Values)))
+		return s.replayRows(ctx, rows, callback)
+	}
 
 	return callback(res)
 }
@@ -186,15 +364,36 @@ func (s *rdbms) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result,
 	if err != nil {
 		return nil, errTracer(err)
 	}
+	if err = s.guardStatement(ctx, query, rawQuery); err != nil {
+		return nil, errTracer(err)
+	}
+	if s.readOnlySession(ctx, rawQuery) || s.tenantInOwnTx(ctx) || s.auditInOwnTx(ctx, rawQuery) {
+		var res sql.Result
+		err = s.doOwnTx(ctx, isIdempotent(ctx), nil, func(ctx context.Context, tx Rdbms) (err error) {
+			res, err = tx.ExecSq(ctx, query)
+			return err
+		})
+		return res, err
+	}
 
-	ctx, spanExec := s.tracer.Start(ctx, s.spanNameFunc(rawQuery), s.commonAttribute(rawQuery, args)...)
+	ctx, spanExec := s.tracer.Start(ctx, s.spanNameFunc(rawQuery), s.commonAttribute(ctx, rawQuery, args)...)
 	defer spanExec.End()
 
-	res, err := s.queryExecutor.ExecContext(ctx, rawQuery, args...)
+	release, err := s.acquire(ctx)
+	if err != nil {
+		recordError(spanExec, err)
+		return nil, err
+	}
+	defer release()
+
+	res, err := s.exec(ctx, rawQuery, args)
 	if err != nil {
 		recordError(spanExec, err)
 		return nil, err
 	}
+	s.invalidateCache(ctx, rawQuery)
+	rowsAffected, _ := res.RowsAffected()
+	s.recordAudit(ctx, rawQuery, args, rowsAffected)
 
 	return res, nil
 }
@@ -204,17 +403,42 @@ func (s *rdbms) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType
 	if err != nil {
 		return errTracer(err)
 	}
+	if err = s.guardStatement(ctx, query, rawQuery); err != nil {
+		return errTracer(err)
+	}
+	if s.readOnlySession(ctx, rawQuery) || s.tenantInOwnTx(ctx) || s.auditInOwnTx(ctx, rawQuery) {
+		return s.doOwnTx(ctx, cacheableStatement(rawQuery) || isIdempotent(ctx), nil, func(ctx context.Context, tx Rdbms) error {
+			return tx.QueryRowSq(ctx, query, scanType, dest)
+		})
+	}
 
-	ctx, spanQueryx := s.tracer.Start(ctx, s.spanNameFunc(rawQuery), s.commonAttribute(rawQuery, args)...)
+	ctx, spanQueryx := s.tracer.Start(ctx, s.spanNameFunc(rawQuery), s.commonAttribute(ctx, rawQuery, args)...)
 	defer spanQueryx.End()
 
-	res := s.queryExecutor.QueryRowxContext(ctx, rawQuery, args...)
-
-	switch scanType {
-	case QueryRowScanTypeStruct:
-		err = res.StructScan(dest)
-	default:
-		err = res.Scan(dest)
+	if ttl, ok := s.cacheTTL(ctx, rawQuery); ok {
+		var rows *materializedRows
+		var hit bool
+		rows, hit, err = s.cachedRows(ctx, rawQuery, args, ttl)
+		if err == nil {
+			spanQueryx.SetAttributes(DBCacheHit.Bool(hit))
+			err = scanRow(rows.QueryRow(ctx, s.db), scanType, dest)
+		}
+	} else {
+		var release func()
+		release, err = s.acquire(ctx)
+		if err == nil {
+			s.countQuery(ctx, rawQuery)
+			err = s.call(ctx, cacheableStatement(rawQuery) || isIdempotent(ctx), func() error {
+				return scanRow(s.queryExecutor.QueryRowxContext(ctx, rawQuery, args...), scanType, dest)
+			})
+			release()
+			if err == nil {
+				if !cacheableStatement(rawQuery) {
+					s.invalidateCache(ctx, rawQuery)
+				}
+				s.recordAudit(ctx, rawQuery, args, 1)
+			}
+		}
 	}
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) {
@@ -226,51 +450,340 @@ func (s *rdbms) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType
 	return nil
 }
 
+func scanRow(row *sqlx.Row, scanType QueryRowScanType, dest interface{}) error {
+	switch scanType {
+	case QueryRowScanTypeStruct:
+		return row.StructScan(dest)
+	default:
+		return row.Scan(dest)
+	}
+}
+
 func (s *rdbms) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, paginationInput PaginationInput, callback callbackRows) (
 	PaginationOutput, error) {
 
 	offset := paginationInput.Offset()
-	query = query.Limit(uint64(paginationInput.PageSize))
-	query = query.Offset(uint64(offset))
+	dataQuery := query.Limit(uint64(paginationInput.PageSize))
+	dataQuery = dataQuery.Offset(uint64(offset))
+
+	if s.estimateThreshold > 0 {
+		estimate, err := s.cachedEstimateCount(ctx, query)
+		if err == nil && estimate > s.estimateThreshold {
+			err = s.QuerySq(ctx, dataQuery, callback)
+			if err != nil {
+				return PaginationOutput{}, errTracer(err)
+			}
+
+			output, err := s.paginationOutput(paginationInput, estimate)
+			if err != nil {
+				return PaginationOutput{}, err
+			}
+			output.IsEstimate = true
+			return output, nil
+		}
+	}
 
 	totalData := int64(0)
-	err := s.QueryRowSq(ctx, countQuery, QueryRowScanTypeDefault, &totalData)
+	err := s.countAndQuery(ctx, func(ctx context.Context) error {
+		return s.QueryRowSq(ctx, countQuery, QueryRowScanTypeDefault, &totalData)
+	}, func(ctx context.Context) error {
+		return s.QuerySq(ctx, dataQuery, callback)
+	})
+	if err != nil {
+		return PaginationOutput{}, errTracer(err)
+	}
+
+	return s.paginationOutput(paginationInput, totalData)
+}
+
+// QuerySqPaginationAuto is QuerySqPagination with the count query derived from
+// query according to strategy, so the filters of both can't drift apart.
+func (s *rdbms) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, paginationInput PaginationInput, strategy CountStrategy, callback callbackRows) (
+	PaginationOutput, error) {
+
+	if strategy != CountStrategyWindow {
+		return s.QuerySqPagination(ctx, deriveCountQuery(query, strategy), query, paginationInput, callback)
+	}
+
+	countQuery := deriveCountQuery(query, CountStrategySubquery)
+	query = query.Column("COUNT(*) OVER() AS " + windowCountColumn)
+	query = query.Limit(uint64(paginationInput.PageSize))
+	query = query.Offset(uint64(paginationInput.Offset()))
+
+	rows, err := s.querySqMaterialized(ctx, query)
+	if err != nil {
+		return PaginationOutput{}, errTracer(err)
+	}
+
+	totalData, err := splitWindowCount(rows)
 	if err != nil {
 		return PaginationOutput{}, errTracer(err)
 	}
 
-	err = s.QuerySq(ctx, query, callback)
+	// A page past the last one has no row to read the count from.
+	if len(rows.Values) == 0 && paginationInput.Offset() > 0 {
+		err = s.QueryRowSq(ctx, countQuery, QueryRowScanTypeDefault, &totalData)
+		if err != nil {
+			return PaginationOutput{}, errTracer(err)
+		}
+	}
+
+	err = s.replayRows(ctx, rows, callback)
 	if err != nil {
 		return PaginationOutput{}, errTracer(err)
 	}
 
-	return CreatePaginationOutput(paginationInput, totalData), nil
+	return s.paginationOutput(paginationInput, totalData)
+}
+
+// QuerySqPaginationNoCount paginates query without counting its rows. It
+// fetches one row more than the page size to find out whether a next page
+// exists, the callback only receives the rows of the requested page. A PageSize
+// below 1 returns ErrInvalidPageSize.
+func (s *rdbms) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, paginationInput PaginationInput, callback callbackRows) (
+	PaginationNoCountOutput, error) {
+	if paginationInput.PageSize < 1 {
+		return PaginationNoCountOutput{}, errTracer(ErrInvalidPageSize)
+	}
+
+	query = query.Limit(uint64(paginationInput.PageSize) + 1)
+	query = query.Offset(uint64(paginationInput.Offset()))
+
+	rows, err := s.querySqMaterialized(ctx, query)
+	if err != nil {
+		return PaginationNoCountOutput{}, errTracer(err)
+	}
+
+	hasNext := int64(len(rows.Values)) > paginationInput.PageSize
+	if hasNext {
+		rows.Values = rows.Values[:paginationInput.PageSize]
+	}
+
+	err = s.replayRows(ctx, rows, callback)
+	if err != nil {
+		return PaginationNoCountOutput{}, errTracer(err)
+	}
+
+	return CreatePaginationNoCountOutput(paginationInput, hasNext), nil
+}
+
+// querySqMaterialized runs query through QuerySq and reads its whole result,
+// so it can be altered before being handed to a callback with replayRows.
+func (s *rdbms) querySqMaterialized(ctx context.Context, query squirrel.Sqlizer) (rows *materializedRows, err error) {
+	err = s.QuerySq(ctx, query, func(res *sqlx.Rows) (err error) {
+		rows, err = materializeRows(res)
+		return err
+	})
+	return rows, err
+}
+
+func (s *rdbms) replayRows(ctx context.Context, rows *materializedRows, callback callbackRows) error {
+	res, err := rows.Query(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	return callback(res)
+}
+
+// paginationOutput creates the output of a paginated query from its exact or
+// estimated count, applying the configured OutOfRangeBehaviour.
+func (s *rdbms) paginationOutput(paginationInput PaginationInput, totalData int64) (PaginationOutput, error) {
+	output := CreatePaginationOutput(paginationInput, totalData)
+	if output.OutOfRange && s.outOfRangeBehaviour == OutOfRangeError {
+		return PaginationOutput{}, errTracer(ErrPageOutOfRange)
+	}
+
+	return output, nil
+}
+
+// countAndQuery runs the count and the data query of a paginated query. With
+// WithConcurrentPagination they run concurrently on separate connections and
+// the first error cancels the other one. Inside a transaction there is only one
+// connection, so they always run sequentially.
+func (s *rdbms) countAndQuery(ctx context.Context, count, query func(ctx context.Context) error) error {
+	if !s.concurrentPagination || s.tx != nil {
+		if err := count(ctx); err != nil {
+			return err
+		}
+		return query(ctx)
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		return count(gctx)
+	})
+	g.Go(func() error {
+		return query(gctx)
+	})
+
+	return g.Wait()
+}
+
+// BindTx returns a copy of the rdbms executing every query in tx, which is
+// owned by the caller. DoTx on the returned rdbms runs its callback in a
+// savepoint of tx.
+func (s *rdbms) BindTx(tx *sqlx.Tx) *rdbms {
+	return s.injectTx(tx)
 }
 
 func (s *rdbms) injectTx(tx *sqlx.Tx) *rdbms {
 	newRdbms := *s
 	newRdbms.queryExecutor = tx
+	newRdbms.tx = &txState{tx: tx}
 	return &newRdbms
 }
 
+// txState is shared by every Rdbms bound to the same transaction and holds the
+// work that has to be deferred until the transaction is committed.
+type txState struct {
+	tx *sqlx.Tx
+
+	mu                   sync.Mutex
+	pendingInvalidations []string
+	auditEntries         []AuditEntry
+	locks                []string
+	savepoints           int
+}
+
+func (t *txState) nextSavepoint() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.savepoints++
+	return fmt.Sprintf("wsqlx_sp_%d", t.savepoints)
+}
+
+func (t *txState) addPendingInvalidation(tags ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pendingInvalidations = append(t.pendingInvalidations, tags...)
+}
+
+func (t *txState) takePendingInvalidations() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tags := t.pendingInvalidations
+	t.pendingInvalidations = nil
+	return tags
+}
+
+func (t *txState) addAuditEntry(entry AuditEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.auditEntries = append(t.auditEntries, entry)
+}
+
+func (t *txState) addLock(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.locks = append(t.locks, key)
+}
+
+func (t *txState) takeLocks() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	locks := t.locks
+	t.locks = nil
+	return locks
+}
+
+// auditSnapshot returns a copy of the audit entries recorded so far.
+func (t *txState) auditSnapshot() []AuditEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]AuditEntry(nil), t.auditEntries...)
+}
+
+// auditMark and rollbackAudit drop the audit entries of a rolled back savepoint.
+func (t *txState) auditMark() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.auditEntries)
+}
+
+func (t *txState) rollbackAudit(mark int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.auditEntries = t.auditEntries[:mark]
+}
+
+// afterCommit runs the work deferred by txState once the transaction committed.
+func (s *rdbms) afterCommit(ctx context.Context, tx *rdbms) {
+	if tags := tx.tx.takePendingInvalidations(); s.cache != nil && len(tags) > 0 {
+		s.cache.InvalidateTags(ctx, tags...)
+	}
+	s.writeAudit(ctx, tx.tx.auditSnapshot())
+}
+
+// DoTx runs fn in a transaction, which is committed when fn returns nil and
+// rolled back otherwise. On an rdbms bound to a transaction, i.e. the Rdbms
+// passed to fn or one returned by BindTx, DoTx runs fn in a savepoint of that
+// transaction instead and ignores opt: a failing fn only rolls back its own
+// work, and the outer transaction decides whether everything is committed.
 func (s *rdbms) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx Rdbms) (err error)) (err error) {
+	return s.doTx(ctx, opt, func(_ context.Context, tx Rdbms) error {
+		return fn(tx)
+	})
+}
+
+// DoTxContext is DoTx passing the context of the transaction span to fn.
+func (s *rdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx Rdbms) (err error)) (err error) {
+	return s.doTx(ctx, opt, fn)
+}
+
+func (s *rdbms) doTx(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx Rdbms) (err error)) (err error) {
+	if s.tx != nil {
+		return s.doSavepoint(ctx, fn)
+	}
+	if err = s.guardTenant(ctx); err != nil {
+		return errTracer(err)
+	}
+	if s.readOnly != nil {
+		opt = readOnlyTxOptions(opt)
+	}
+
 	opts := []trace.SpanStartOption{
 		trace.WithSpanKind(trace.SpanKindClient),
 		trace.WithAttributes(DBTxIsolationLevel.String(opt.Isolation.String())),
 		trace.WithAttributes(DBTxReadOnly.Bool(opt.ReadOnly)),
 	}
+	if shardID, ok := shardIDFromContext(ctx); ok {
+		opts = append(opts, trace.WithAttributes(DBShardID.String(shardID)))
+	}
 
 	spanName := "do transaction"
 
-	_, span := s.tracer.Start(ctx, spanName, opts...)
+	ctx, span := s.tracer.Start(ctx, spanName, opts...)
 	defer span.End()
 
-	tx, err := s.db.BeginTxx(ctx, opt)
+	var tx *sqlx.Tx
+	var conn *sqlx.Conn
+	err = s.call(ctx, false, func() (err error) {
+		tx, conn, err = s.beginTx(ctx, opt)
+		return err
+	})
 	if err != nil {
 		recordError(span, err)
 		return errTracer(err)
 	}
+	if err = s.beginTenant(ctx, tx); err != nil {
+		recordError(span, err)
+		err = errors.Join(err, tx.Rollback())
+		if conn != nil {
+			err = errors.Join(err, conn.Close())
+		}
+		return errTracer(err)
+	}
+	txRdbms := s.injectTx(tx)
 
+	if conn != nil {
+		defer func() {
+			if errRelease := s.releaseTxLocks(ctx, conn, txRdbms); errRelease != nil {
+				recordError(span, errRelease)
+			}
+		}()
+	}
 	defer func() {
 		if p := recover(); p != nil {
 			span.SetAttributes(attribute.String("db.tx.operation", "rollback"))
@@ -300,40 +813,91 @@ func (s *rdbms) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx Rdbms)
 				span.SetAttributes(attribute.String("db.tx.status", "commit failed"))
 			} else {
 				span.SetAttributes(attribute.String("db.tx.status", "commit successfully"))
+				s.afterCommit(ctx, txRdbms)
 			}
 		}
 	}()
 
-	err = fn(s.injectTx(tx))
+	err = fn(ctx, txRdbms)
+	if err == nil {
+		err = s.writeTxAudit(ctx, txRdbms)
+	}
 	if err != nil {
 		recordError(span, err)
 	}
 	return
 }
 
-func (s *rdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx Rdbms) (err error)) (err error) {
-	opts := []trace.SpanStartOption{
-		trace.WithSpanKind(trace.SpanKindClient),
-		trace.WithAttributes(DBTxIsolationLevel.String(opt.Isolation.String())),
-		trace.WithAttributes(DBTxReadOnly.Bool(opt.ReadOnly)),
+// beginTx begins a transaction. On MySQL it is begun on a connection of its
+// own, which is returned too: the locks taken with LockTx outlive the
+// transaction and are released on it by releaseTxLocks.
+func (s *rdbms) beginTx(ctx context.Context, opt *sql.TxOptions) (*sqlx.Tx, *sqlx.Conn, error) {
+	if s.dialect != DialectMySQL {
+		tx, err := s.db.BeginTxx(ctx, opt)
+		return tx, nil, err
 	}
 
-	spanName := "do transaction"
+	conn, err := s.db.Connx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := conn.BeginTxx(ctx, opt)
+	if err != nil {
+		return nil, nil, errors.Join(err, conn.Close())
+	}
+	return tx, conn, nil
+}
 
-	ctx, span := s.tracer.Start(ctx, spanName, opts...)
+// doOwnTx runs a single statement in a transaction of its own, which read-only
+// sessions, tenants and transactional audit sinks need. Like a statement run
+// directly, it holds a limiter slot and is retried as a whole, except after
+// delivered was set: the rows were handed to a callback then.
+func (s *rdbms) doOwnTx(ctx context.Context, idempotent bool, delivered *bool, fn func(ctx context.Context, tx Rdbms) error) error {
+	release, err := s.acquire(ctx)
+	if err != nil {
+		return errTracer(err)
+	}
+	defer release()
+
+	err = s.retry(ctx, idempotent, func() error {
+		err := s.doTx(ctx, &sql.TxOptions{}, fn)
+		if err != nil && delivered != nil && *delivered {
+			return permanentError{err: err}
+		}
+		return err
+	})
+
+	var permanent permanentError
+	if errors.As(err, &permanent) {
+		return permanent.err
+	}
+	return err
+}
+
+// doSavepoint runs fn in a savepoint of the transaction the rdbms is bound to,
+// which makes nested DoTx calls roll back only their own work. The isolation
+// level and read-only mode of the outer transaction apply. The rollback runs
+// even if ctx is done, as the outer transaction may still commit.
+func (s *rdbms) doSavepoint(ctx context.Context, fn func(ctx context.Context, tx Rdbms) (err error)) (err error) {
+	savepoint := s.tx.nextSavepoint()
+	auditMark := s.tx.auditMark()
+
+	ctx, span := s.tracer.Start(ctx, "do transaction",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(DBTxSavepoint.String(savepoint)),
+	)
 	defer span.End()
 
-	tx, err := s.db.BeginTxx(ctx, opt)
-	if err != nil {
+	if _, err = s.queryExecutor.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
 		recordError(span, err)
 		return errTracer(err)
 	}
 
 	defer func() {
 		if p := recover(); p != nil {
+			s.tx.rollbackAudit(auditMark)
 			span.SetAttributes(attribute.String("db.tx.operation", "rollback"))
-			errRollback := tx.Rollback()
-			if errRollback != nil {
+			if _, errRollback := s.queryExecutor.ExecContext(context.WithoutCancel(ctx), "ROLLBACK TO SAVEPOINT "+savepoint); errRollback != nil {
 				recordError(span, errRollback)
 				span.SetAttributes(attribute.String("db.tx.status", "rollback failed"))
 			} else {
@@ -342,8 +906,9 @@ func (s *rdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx
 			recordError(span, fmt.Errorf("panic occurred: %v", p))
 			panic(p)
 		} else if err != nil {
+			s.tx.rollbackAudit(auditMark)
 			span.SetAttributes(attribute.String("db.tx.operation", "rollback"))
-			if errRollback := tx.Rollback(); errRollback != nil {
+			if _, errRollback := s.queryExecutor.ExecContext(context.WithoutCancel(ctx), "ROLLBACK TO SAVEPOINT "+savepoint); errRollback != nil {
 				recordError(span, errRollback)
 				err = errors.Join(err, errRollback)
 				span.SetAttributes(attribute.String("db.tx.status", "rollback failed"))
@@ -352,9 +917,9 @@ func (s *rdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx
 			}
 		} else {
 			span.SetAttributes(attribute.String("db.tx.operation", "commit"))
-			if errCommit := tx.Commit(); errCommit != nil {
-				recordError(span, errCommit)
-				err = errCommit
+			if _, errRelease := s.queryExecutor.ExecContext(ctx, "RELEASE SAVEPOINT "+savepoint); errRelease != nil {
+				recordError(span, errRelease)
+				err = errRelease
 				span.SetAttributes(attribute.String("db.tx.status", "commit failed"))
 			} else {
 				span.SetAttributes(attribute.String("db.tx.status", "commit successfully"))
@@ -362,6 +927,9 @@ func (s *rdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx
 		}
 	}()
 
-	err = fn(ctx, s.injectTx(tx))
+	err = fn(ctx, s)
+	if err != nil {
+		recordError(span, err)
+	}
 	return
 }
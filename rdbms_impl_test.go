@@ -99,3 +99,85 @@ func Test_sqlxWrapper_Queryx(t *testing.T) {
 		require.NoError(t, mock.ExpectationsWereMet())
 	})
 }
+
+func Test_rdbms_DoTx_Nested(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"))
+	insert := squirrel.Insert("users").Columns("name").Values("iban")
+
+	t.Run("should run nested DoTx in a savepoint of the outer transaction", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?)`)).
+			WithArgs("iban").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`RELEASE SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			return tx.(wsqlx.Tx).DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+				_, err := tx.ExecSq(ctx, insert)
+				return err
+			})
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should roll back only the savepoint of a failed nested DoTx", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`ROLLBACK TO SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?)`)).
+			WithArgs("iban").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		errNested := errors.New("nested")
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			err := tx.(wsqlx.Tx).DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+				return errNested
+			})
+			require.ErrorIs(t, err, errNested)
+
+			_, err = tx.ExecSq(ctx, insert)
+			return err
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should roll back the savepoint when its context is canceled", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`ROLLBACK TO SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			nestedCtx, cancel := context.WithCancel(ctx)
+			err := tx.(wsqlx.Tx).DoTxContext(nestedCtx, &sql.TxOptions{}, func(ctx context.Context, tx wsqlx.Rdbms) error {
+				cancel()
+				return ctx.Err()
+			})
+			require.ErrorIs(t, err, context.Canceled)
+			return nil
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_NewRdbms(t *testing.T) {
+	t.Run("should not panic without db", func(t *testing.T) {
+		require.NotPanics(t, func() {
+			wsqlx.NewRdbms(nil)
+		})
+	})
+}
@@ -99,6 +99,36 @@ func (mr *MockRdbmsMockRecorder) QuerySqPagination(ctx, countQuery, query, pagin
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuerySqPagination", reflect.TypeOf((*MockRdbms)(nil).QuerySqPagination), ctx, countQuery, query, pagination, callback)
 }
 
+// QuerySqPaginationAuto mocks base method.
+func (m *MockRdbms) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination PaginationInput, strategy CountStrategy, callback callbackRows) (PaginationOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuerySqPaginationAuto", ctx, query, pagination, strategy, callback)
+	ret0, _ := ret[0].(PaginationOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QuerySqPaginationAuto indicates an expected call of QuerySqPaginationAuto.
+func (mr *MockRdbmsMockRecorder) QuerySqPaginationAuto(ctx, query, pagination, strategy, callback any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuerySqPaginationAuto", reflect.TypeOf((*MockRdbms)(nil).QuerySqPaginationAuto), ctx, query, pagination, strategy, callback)
+}
+
+// QuerySqPaginationNoCount mocks base method.
+func (m *MockRdbms) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination PaginationInput, callback callbackRows) (PaginationNoCountOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuerySqPaginationNoCount", ctx, query, pagination, callback)
+	ret0, _ := ret[0].(PaginationNoCountOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QuerySqPaginationNoCount indicates an expected call of QuerySqPaginationNoCount.
+func (mr *MockRdbmsMockRecorder) QuerySqPaginationNoCount(ctx, query, pagination, callback any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuerySqPaginationNoCount", reflect.TypeOf((*MockRdbms)(nil).QuerySqPaginationNoCount), ctx, query, pagination, callback)
+}
+
 // MockWriterCommand is a mock of WriterCommand interface.
 type MockWriterCommand struct {
 	ctrl     *gomock.Controller
@@ -203,6 +233,36 @@ func (mr *MockReadQueryMockRecorder) QuerySqPagination(ctx, countQuery, query, p
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuerySqPagination", reflect.TypeOf((*MockReadQuery)(nil).QuerySqPagination), ctx, countQuery, query, pagination, callback)
 }
 
+// QuerySqPaginationAuto mocks base method.
+func (m *MockReadQuery) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination PaginationInput, strategy CountStrategy, callback callbackRows) (PaginationOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuerySqPaginationAuto", ctx, query, pagination, strategy, callback)
+	ret0, _ := ret[0].(PaginationOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QuerySqPaginationAuto indicates an expected call of QuerySqPaginationAuto.
+func (mr *MockReadQueryMockRecorder) QuerySqPaginationAuto(ctx, query, pagination, strategy, callback any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuerySqPaginationAuto", reflect.TypeOf((*MockReadQuery)(nil).QuerySqPaginationAuto), ctx, query, pagination, strategy, callback)
+}
+
+// QuerySqPaginationNoCount mocks base method.
+func (m *MockReadQuery) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination PaginationInput, callback callbackRows) (PaginationNoCountOutput, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QuerySqPaginationNoCount", ctx, query, pagination, callback)
+	ret0, _ := ret[0].(PaginationNoCountOutput)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// QuerySqPaginationNoCount indicates an expected call of QuerySqPaginationNoCount.
+func (mr *MockReadQueryMockRecorder) QuerySqPaginationNoCount(ctx, query, pagination, callback any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QuerySqPaginationNoCount", reflect.TypeOf((*MockReadQuery)(nil).QuerySqPaginationNoCount), ctx, query, pagination, callback)
+}
+
 // MockqueryExecutor is a mock of queryExecutor interface.
 type MockqueryExecutor struct {
 	ctrl     *gomock.Controller
@@ -0,0 +1,79 @@
+package wsqlx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrReadOnly is returned for statements that may write when WithReadOnly is
+// enabled.
+var ErrReadOnly = errors.New("wsqlx: statement is not allowed on a read-only rdbms")
+
+type ReadOnlyConfig struct {
+	// Session enforces read-only at the database level too: the statements
+	// outside a transaction run in a read-only transaction of their own, except
+	// the ones served by the query cache. Transactions are always begun with
+	// sql.TxOptions.ReadOnly, which the Postgres and MySQL drivers pass to the
+	// database.
+	Session bool
+}
+
+// WithReadOnly turns the rdbms into a read-only one: statements other than
+// SELECT, WITH, SHOW and EXPLAIN, and SELECT with a locking clause like FOR
+// UPDATE, fail with ErrReadOnly before reaching the database, and DoTx always
+// begins read-only transactions. The statement check is a best-effort scan,
+// functions with side effects are only caught by ReadOnlyConfig.Session. Use
+// Derive to get a read-only copy of an rdbms.
+func WithReadOnly(config ReadOnlyConfig) optionFunc {
+	return func(cfg *rdbms) {
+		cfg.readOnly = &config
+	}
+}
+
+var (
+	readOnlyOperations = map[string]struct{}{"SELECT": {}, "WITH": {}, "SHOW": {}, "EXPLAIN": {}}
+	writeKeywordRegex  = regexp.MustCompile(`(?i)\b(?:INSERT|DELETE|MERGE|INTO|TRUNCATE|ANALYZE)\b|\bUPDATE\s+[\w."` + "`" + `]+\s+SET\b` +
+		`|\bFOR\s+(?:NO\s+KEY\s+)?UPDATE\b|\bFOR\s+(?:KEY\s+)?SHARE\b|\bLOCK\s+IN\s+SHARE\s+MODE\b`)
+)
+
+// guardReadOnly rejects rawQuery unless it is a read-only statement.
+func (s *rdbms) guardReadOnly(rawQuery string) error {
+	if s.readOnly == nil {
+		return nil
+	}
+
+	stmt := stringLiteralRegex.ReplaceAllString(normalizeSQL(rawQuery), "?")
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	operation := strings.ToUpper(fields[0])
+	if _, ok := readOnlyOperations[operation]; !ok || writeKeywordRegex.MatchString(stmt) {
+		return fmt.Errorf("%w: %s", ErrReadOnly, operation)
+	}
+	return nil
+}
+
+// readOnlySession reports whether a statement has to be run in a read-only
+// transaction of its own, see ReadOnlyConfig.Session.
+func (s *rdbms) readOnlySession(ctx context.Context, rawQuery string) bool {
+	if s.readOnly == nil || !s.readOnly.Session || s.tx != nil {
+		return false
+	}
+
+	_, cached := s.cacheTTL(ctx, rawQuery)
+	return !cached
+}
+
+func readOnlyTxOptions(opt *sql.TxOptions) *sql.TxOptions {
+	readOnlyOpt := sql.TxOptions{ReadOnly: true}
+	if opt != nil {
+		readOnlyOpt.Isolation = opt.Isolation
+	}
+	return &readOnlyOpt
+}
@@ -0,0 +1,133 @@
+package wsqlx_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rdbms_ReadOnly(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithDialect(wsqlx.DialectPostgres))
+	ctx := context.TODO()
+
+	t.Run("should reject statements that may write", func(t *testing.T) {
+		readOnly := sqlxx.Derive(wsqlx.WithReadOnly(wsqlx.ReadOnlyConfig{}))
+
+		_, err = readOnly.ExecSq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+		require.ErrorIs(t, err, wsqlx.ErrReadOnly)
+
+		err = readOnly.QuerySq(ctx, squirrel.Expr("WITH deleted AS (DELETE FROM users RETURNING id) SELECT id FROM deleted"),
+			func(rows *sqlx.Rows) error { return nil })
+		require.ErrorIs(t, err, wsqlx.ErrReadOnly)
+
+		var name string
+		err = readOnly.QueryRowSq(ctx, squirrel.Expr("UPDATE users SET name = 'x' RETURNING name"), wsqlx.QueryRowScanTypeDefault, &name)
+		require.ErrorIs(t, err, wsqlx.ErrReadOnly)
+
+		err = readOnly.QueryRowSq(ctx, squirrel.Select("name").From("users").Where(squirrel.Eq{"id": 1}).Suffix("FOR UPDATE"),
+			wsqlx.QueryRowScanTypeDefault, &name)
+		require.ErrorIs(t, err, wsqlx.ErrReadOnly)
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT name FROM users WHERE updated_at > ?`)).
+			WithArgs("2024-01-01").
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("iban"))
+		err = readOnly.QueryRowSq(ctx, squirrel.Select("name").From("users").Where(squirrel.Gt{"updated_at": "2024-01-01"}),
+			wsqlx.QueryRowScanTypeDefault, &name)
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should begin read-only transactions", func(t *testing.T) {
+		readOnly := sqlxx.Derive(wsqlx.WithReadOnly(wsqlx.ReadOnlyConfig{Session: true}))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectCommit()
+
+		err = readOnly.DoTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead}, func(tx wsqlx.Rdbms) error {
+			var count int64
+			if err := tx.QueryRowSq(ctx, squirrel.Select("COUNT(*)").From("users"), wsqlx.QueryRowScanTypeDefault, &count); err != nil {
+				return err
+			}
+			_, err := tx.ExecSq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+			require.ErrorIs(t, err, wsqlx.ErrReadOnly)
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run statements outside transactions in a read-only transaction", func(t *testing.T) {
+		readOnly := sqlxx.Derive(wsqlx.WithReadOnly(wsqlx.ReadOnlyConfig{Session: true}))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT name FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("iban"))
+		mock.ExpectCommit()
+
+		names := make([]string, 0)
+		err = readOnly.QuerySq(ctx, squirrel.Select("name").From("users"), func(rows *sqlx.Rows) error {
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					return err
+				}
+				names = append(names, name)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"iban"}, names)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should retry the read-only transaction of a statement", func(t *testing.T) {
+		readOnly := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"),
+			wsqlx.WithReadOnly(wsqlx.ReadOnlyConfig{Session: true}),
+			wsqlx.WithRetryPolicy(wsqlx.RetryPolicy{MaxAttempts: 2}))
+
+		mock.ExpectBegin().WillReturnError(errConnReset)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+		mock.ExpectCommit()
+
+		var count int64
+		err = readOnly.QueryRowSq(ctx, squirrel.Select("COUNT(*)").From("users"), wsqlx.QueryRowScanTypeDefault, &count)
+		require.NoError(t, err)
+		require.Equal(t, int64(2), count)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not retry once the rows were handed to the callback", func(t *testing.T) {
+		readOnly := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"),
+			wsqlx.WithReadOnly(wsqlx.ReadOnlyConfig{Session: true}),
+			wsqlx.WithRetryPolicy(wsqlx.RetryPolicy{MaxAttempts: 2}))
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT name FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("iban"))
+		mock.ExpectCommit().WillReturnError(errConnReset)
+
+		calls := 0
+		err = readOnly.QuerySq(ctx, squirrel.Select("name").From("users"), func(rows *sqlx.Rows) error {
+			calls++
+			return nil
+		})
+		require.ErrorIs(t, err, errConnReset)
+		require.Equal(t, 1, calls)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,149 @@
+package wsqlx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryPolicy configures how transient errors are retried. Reads are retried
+// outside transactions, writes, including those with a RETURNING clause run by
+// QuerySq or QueryRowSq, only when the context is marked with
+// ContextWithIdempotent. Nothing is retried inside a DoTx callback.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the second attempt, doubled after each
+	// following attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Jitter randomizes each wait by up to the given fraction (0 to 1).
+	Jitter float64
+	// Retryable reports whether an error is worth retrying. IsTransientError is
+	// used when nil.
+	Retryable func(err error) bool
+}
+
+// WithRetryPolicy enables retrying of transient errors.
+func WithRetryPolicy(policy RetryPolicy) optionFunc {
+	return func(cfg *rdbms) {
+		if policy.Retryable == nil {
+			policy.Retryable = IsTransientError
+		}
+		cfg.retryPolicy = &policy
+	}
+}
+
+type idempotentKey struct{}
+
+// ContextWithIdempotent marks the writes executed with the returned context as
+// safe to retry.
+func ContextWithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+func isIdempotent(ctx context.Context) bool {
+	idempotent, _ := ctx.Value(idempotentKey{}).(bool)
+	return idempotent
+}
+
+// IsTransientError reports whether err looks like a dropped or refused
+// connection, which typically happens during a database failover.
+func IsTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"connection reset", "bad connection", "broken pipe", "connection refused"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Backoff returns the wait after the failed attempt, starting at 1.
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < attempt && wait < math.MaxInt64/2 && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+
+	if p.Jitter > 0 {
+		wait -= time.Duration(rand.Float64() * p.Jitter * float64(wait))
+	}
+
+	return wait
+}
+
+// permanentError marks an error retry must not retry, whatever the policy.
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// retry runs fn, retrying it according to the retry policy. Every failed
+// attempt is added as an event to the span in ctx.
+func (s *rdbms) retry(ctx context.Context, idempotent bool, fn func() error) error {
+	if s.retryPolicy == nil || s.tx != nil || !idempotent {
+		return fn()
+	}
+
+	span := trace.SpanFromContext(ctx)
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= s.retryPolicy.MaxAttempts || !s.retryPolicy.Retryable(err) || errors.As(err, new(permanentError)) {
+			return err
+		}
+
+		wait := s.retryPolicy.Backoff(attempt)
+		span.AddEvent("db.retry", trace.WithAttributes(
+			attribute.Int("db.retry.attempt", attempt),
+			attribute.String("db.retry.error", err.Error()),
+			attribute.String("db.retry.backoff", wait.String()),
+		))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package wsqlx_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+var errConnReset = errors.New("read tcp 127.0.0.1:5432: connection reset by peer")
+
+func Test_rdbms_Retry(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+	sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithRetryPolicy(wsqlx.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+	}))
+
+	t.Run("should retry read on transient error", func(t *testing.T) {
+		query := squirrel.Select("id").From("users").Where(squirrel.Eq{"id": 1})
+
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnError(errConnReset)
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		var id int
+		err = sqlxx.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+		require.NoError(t, err)
+		require.Equal(t, 1, id)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not retry write without idempotent context", func(t *testing.T) {
+		query := squirrel.Delete("users").Where(squirrel.Eq{"id": 1})
+
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnError(errConnReset)
+
+		_, err = sqlxx.ExecSq(ctx, query)
+		require.Error(t, err)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not retry write with RETURNING without idempotent context", func(t *testing.T) {
+		query := squirrel.Insert("users").Columns("name").Values("iban").Suffix("RETURNING id")
+
+		for name, run := range map[string]func(db wsqlx.Rdbms) error{
+			"QueryRowSq": func(db wsqlx.Rdbms) error {
+				var id int
+				return db.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+			},
+			"QuerySq": func(db wsqlx.Rdbms) error {
+				return db.QuerySq(ctx, query, func(rows *sqlx.Rows) error { return nil })
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				dbMock, mock, err := sqlmock.New()
+				require.NoError(t, err)
+				defer dbMock.Close()
+
+				sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithRetryPolicy(wsqlx.RetryPolicy{
+					MaxAttempts:    3,
+					InitialBackoff: time.Millisecond,
+				}))
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?) RETURNING id`)).
+					WithArgs("iban").
+					WillReturnError(errConnReset)
+				mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?) RETURNING id`)).
+					WithArgs("iban").
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+				require.ErrorIs(t, run(sqlxx), errConnReset)
+				// The second insert must not have been issued.
+				require.Error(t, mock.ExpectationsWereMet())
+			})
+		}
+	})
+
+	t.Run("should retry idempotent write on transient error", func(t *testing.T) {
+		query := squirrel.Update("users").Set("name", "iban").Where(squirrel.Eq{"id": 1})
+
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET name = ? WHERE id = ?`)).
+			WithArgs("iban", 1).
+			WillReturnError(errConnReset)
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET name = ? WHERE id = ?`)).
+			WithArgs("iban", 1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		res, err := sqlxx.ExecSq(wsqlx.ContextWithIdempotent(ctx), query)
+		require.NoError(t, err)
+		affected, err := res.RowsAffected()
+		require.NoError(t, err)
+		require.Equal(t, int64(1), affected)
+
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func Test_RetryPolicy_Backoff(t *testing.T) {
+	t.Run("should double without max backoff", func(t *testing.T) {
+		policy := wsqlx.RetryPolicy{InitialBackoff: 10 * time.Millisecond}
+		require.Equal(t, 10*time.Millisecond, policy.Backoff(1))
+		require.Equal(t, 20*time.Millisecond, policy.Backoff(2))
+		require.Equal(t, 80*time.Millisecond, policy.Backoff(4))
+	})
+
+	t.Run("should cap at max backoff", func(t *testing.T) {
+		policy := wsqlx.RetryPolicy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 25 * time.Millisecond}
+		require.Equal(t, 20*time.Millisecond, policy.Backoff(2))
+		require.Equal(t, 25*time.Millisecond, policy.Backoff(3))
+		require.Equal(t, 25*time.Millisecond, policy.Backoff(10))
+	})
+
+	t.Run("should only shorten the wait with jitter", func(t *testing.T) {
+		policy := wsqlx.RetryPolicy{InitialBackoff: 10 * time.Millisecond, Jitter: 0.5}
+		for i := 0; i < 10; i++ {
+			wait := policy.Backoff(2)
+			require.LessOrEqual(t, wait, 20*time.Millisecond)
+			require.GreaterOrEqual(t, wait, 10*time.Millisecond)
+		}
+	})
+}
@@ -0,0 +1,258 @@
+package wsqlx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+var (
+	// ErrShardKeyMissing is returned by HashShardResolver for a context without
+	// shard key.
+	ErrShardKeyMissing = errors.New("wsqlx: no shard key in context")
+	// ErrShardNotFound is returned when the resolver picks an unknown shard.
+	ErrShardNotFound = errors.New("wsqlx: shard not found")
+)
+
+// RdbmsTx is an Rdbms which can begin transactions, like the rdbms returned by
+// NewRdbms.
+type RdbmsTx interface {
+	Rdbms
+	Tx
+}
+
+// ShardResolver returns the ID of the shard the statements executed with ctx
+// are routed to, out of shardIDs.
+type ShardResolver func(ctx context.Context, shardIDs []string) (string, error)
+
+type shardKeyKey struct{}
+
+// ContextWithShardKey sets the key, e.g. a customer ID, HashShardResolver picks
+// the shard of the statements executed with the returned context from.
+func ContextWithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKeyKey{}, key)
+}
+
+// HashShardResolver picks the shard from the FNV-1a hash of the shard key. The
+// mapping changes when shards are added or removed.
+func HashShardResolver(ctx context.Context, shardIDs []string) (string, error) {
+	key, ok := ctx.Value(shardKeyKey{}).(string)
+	if !ok {
+		return "", ErrShardKeyMissing
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return shardIDs[h.Sum32()%uint32(len(shardIDs))], nil
+}
+
+type shardIDKey struct{}
+
+func shardIDFromContext(ctx context.Context) (string, bool) {
+	shardID, ok := ctx.Value(shardIDKey{}).(string)
+	return shardID, ok
+}
+
+// ShardedRdbms routes every statement and transaction to one of several
+// databases holding a part of the same dataset. The spans of the statements
+// are tagged with the shard ID.
+type ShardedRdbms struct {
+	shards   map[string]RdbmsTx
+	shardIDs []string
+	resolver ShardResolver
+	tracer   trace.Tracer
+	// db provides the driver name and mapper the merged rows of QuerySqAll are
+	// scanned with.
+	db *sqlx.DB
+}
+
+var _ RdbmsTx = (*ShardedRdbms)(nil)
+
+// NewShardedRdbms returns a ShardedRdbms routing to shards by shard ID with
+// resolver. HashShardResolver is used when resolver is nil. The tracer provider
+// and the sqlx mapper are taken from the first shard created by NewRdbms.
+func NewShardedRdbms(shards map[string]RdbmsTx, resolver ShardResolver) *ShardedRdbms {
+	if resolver == nil {
+		resolver = HashShardResolver
+	}
+
+	shardIDs := make([]string, 0, len(shards))
+	for shardID := range shards {
+		shardIDs = append(shardIDs, shardID)
+	}
+	sort.Strings(shardIDs)
+
+	tp := otel.GetTracerProvider()
+	var db *sqlx.DB
+	for _, shardID := range shardIDs {
+		if shard, ok := shards[shardID].(*rdbms); ok {
+			tp, db = shard.tracerProvider, shard.db
+			break
+		}
+	}
+
+	return &ShardedRdbms{
+		shards:   shards,
+		shardIDs: shardIDs,
+		resolver: resolver,
+		tracer:   tp.Tracer(TracerName, trace.WithInstrumentationVersion(findOwnImportedVersion())),
+		db:       db,
+	}
+}
+
+// ShardIDs returns the sorted IDs of the shards.
+func (s *ShardedRdbms) ShardIDs() []string {
+	return slices.Clone(s.shardIDs)
+}
+
+// Shard resolves the shard of ctx. The returned context carries the shard ID
+// for the spans.
+func (s *ShardedRdbms) Shard(ctx context.Context) (context.Context, RdbmsTx, error) {
+	if len(s.shardIDs) == 0 {
+		return ctx, nil, errTracer(ErrShardNotFound)
+	}
+
+	shardID, err := s.resolver(ctx, s.shardIDs)
+	if err != nil {
+		return ctx, nil, errTracer(err)
+	}
+
+	shard, ok := s.shards[shardID]
+	if !ok {
+		return ctx, nil, errTracer(fmt.Errorf("%w: %q", ErrShardNotFound, shardID))
+	}
+
+	return context.WithValue(ctx, shardIDKey{}, shardID), shard, nil
+}
+
+func (s *ShardedRdbms) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback callbackRows) error {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return err
+	}
+	return shard.QuerySq(ctx, query, callback)
+}
+
+func (s *ShardedRdbms) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, paginationInput PaginationInput, callback callbackRows) (
+	PaginationOutput, error) {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return PaginationOutput{}, err
+	}
+	return shard.QuerySqPagination(ctx, countQuery, query, paginationInput, callback)
+}
+
+func (s *ShardedRdbms) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, paginationInput PaginationInput, strategy CountStrategy, callback callbackRows) (
+	PaginationOutput, error) {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return PaginationOutput{}, err
+	}
+	return shard.QuerySqPaginationAuto(ctx, query, paginationInput, strategy, callback)
+}
+
+func (s *ShardedRdbms) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, paginationInput PaginationInput, callback callbackRows) (
+	PaginationNoCountOutput, error) {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return PaginationNoCountOutput{}, err
+	}
+	return shard.QuerySqPaginationNoCount(ctx, query, paginationInput, callback)
+}
+
+func (s *ShardedRdbms) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType QueryRowScanType, dest interface{}) error {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return err
+	}
+	return shard.QueryRowSq(ctx, query, scanType, dest)
+}
+
+func (s *ShardedRdbms) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error) {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return shard.ExecSq(ctx, query)
+}
+
+func (s *ShardedRdbms) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx Rdbms) (err error)) (err error) {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return err
+	}
+	return shard.DoTx(ctx, opt, fn)
+}
+
+func (s *ShardedRdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx Rdbms) (err error)) (err error) {
+	ctx, shard, err := s.Shard(ctx)
+	if err != nil {
+		return err
+	}
+	return shard.DoTxContext(ctx, opt, fn)
+}
+
+// QuerySqAll runs query on every shard concurrently and passes the merged rows
+// to callback, in the order of ShardIDs. ORDER BY and LIMIT apply to each shard
+// separately, and every shard has to return the same columns. The first error
+// cancels the queries still running.
+func (s *ShardedRdbms) QuerySqAll(ctx context.Context, query squirrel.Sqlizer, callback callbackRows) error {
+	ctx, span := s.tracer.Start(ctx, "scatter gather",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.Int("db.shard.count", len(s.shardIDs))),
+	)
+	defer span.End()
+
+	results := make([]*materializedRows, len(s.shardIDs))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, shardID := range s.shardIDs {
+		g.Go(func() error {
+			shardCtx := context.WithValue(gctx, shardIDKey{}, shardID)
+			return s.shards[shardID].QuerySq(shardCtx, query, func(rows *sqlx.Rows) (err error) {
+				results[i], err = materializeRows(rows)
+				return err
+			})
+		})
+	}
+	if err := g.Wait(); err != nil {
+		recordError(span, err)
+		return errTracer(err)
+	}
+
+	merged := &materializedRows{Values: make([][]any, 0)}
+	for i, rows := range results {
+		if rows == nil {
+			continue
+		}
+		if merged.Columns == nil {
+			merged.Columns = rows.Columns
+		} else if !slices.Equal(merged.Columns, rows.Columns) {
+			err := fmt.Errorf("wsqlx: shard %q returned columns %v, expected %v", s.shardIDs[i], rows.Columns, merged.Columns)
+			recordError(span, err)
+			return errTracer(err)
+		}
+		merged.Values = append(merged.Values, rows.Values...)
+	}
+
+	rows, err := merged.Query(ctx, s.db)
+	if err == nil {
+		err = callback(rows)
+		err = errors.Join(err, rows.Close())
+	}
+	if err != nil {
+		recordError(span, err)
+		return errTracer(err)
+	}
+	return nil
+}
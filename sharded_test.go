@@ -0,0 +1,134 @@
+package wsqlx_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ShardedRdbms(t *testing.T) {
+	dbMockA, mockA, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMockA.Close()
+	dbMockB, mockB, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMockB.Close()
+
+	sharded := wsqlx.NewShardedRdbms(map[string]wsqlx.RdbmsTx{
+		"a": wsqlx.NewRdbms(sqlx.NewDb(dbMockA, "sqlmock")),
+		"b": wsqlx.NewRdbms(sqlx.NewDb(dbMockB, "sqlmock")),
+	}, nil)
+	require.Equal(t, []string{"a", "b"}, sharded.ShardIDs())
+
+	type user struct {
+		ID   int64  `db:"id"`
+		Name string `db:"name"`
+	}
+
+	t.Run("should route by shard key", func(t *testing.T) {
+		keys := map[string]sqlmock.Sqlmock{}
+		for _, key := range []string{"customer-1", "customer-2", "customer-3", "customer-4"} {
+			resolved, err := wsqlx.HashShardResolver(wsqlx.ContextWithShardKey(context.TODO(), key), sharded.ShardIDs())
+			require.NoError(t, err)
+			if resolved == "a" {
+				keys[key] = mockA
+			} else {
+				keys[key] = mockB
+			}
+		}
+
+		for key, mock := range keys {
+			mock.ExpectBegin()
+			mock.ExpectExec(regexp.QuoteMeta(`UPDATE users SET name = ? WHERE id = ?`)).
+				WithArgs("iban", 1).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			ctx := wsqlx.ContextWithShardKey(context.TODO(), key)
+			err = sharded.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+				_, err := tx.ExecSq(ctx, squirrel.Update("users").Set("name", "iban").Where(squirrel.Eq{"id": 1}))
+				return err
+			})
+			require.NoError(t, err)
+		}
+		require.NoError(t, mockA.ExpectationsWereMet())
+		require.NoError(t, mockB.ExpectationsWereMet())
+	})
+
+	t.Run("should fail without shard key", func(t *testing.T) {
+		_, err = sharded.ExecSq(context.TODO(), squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+		require.ErrorIs(t, err, wsqlx.ErrShardKeyMissing)
+	})
+
+	t.Run("should merge the rows of every shard", func(t *testing.T) {
+		mockA.ExpectQuery(regexp.QuoteMeta(`SELECT id, name FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "iban").AddRow(3, "rama"))
+		mockB.ExpectQuery(regexp.QuoteMeta(`SELECT id, name FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "syaiban"))
+
+		users := make([]user, 0)
+		err = sharded.QuerySqAll(context.TODO(), squirrel.Select("id", "name").From("users"), func(rows *sqlx.Rows) error {
+			for rows.Next() {
+				var u user
+				if err := rows.StructScan(&u); err != nil {
+					return err
+				}
+				users = append(users, u)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []user{{1, "iban"}, {3, "rama"}, {2, "syaiban"}}, users)
+		require.NoError(t, mockA.ExpectationsWereMet())
+		require.NoError(t, mockB.ExpectationsWereMet())
+	})
+
+	t.Run("should scan the merged rows with the mapper of the shards", func(t *testing.T) {
+		jsonDB := sqlx.NewDb(dbMockA, "sqlmock")
+		jsonDB.Mapper = reflectx.NewMapperFunc("json", strings.ToLower)
+		sharded := wsqlx.NewShardedRdbms(map[string]wsqlx.RdbmsTx{"a": wsqlx.NewRdbms(jsonDB)}, nil)
+
+		mockA.ExpectQuery(regexp.QuoteMeta(`SELECT id, name FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "iban"))
+
+		type jsonUser struct {
+			UserID   int64  `json:"id"`
+			FullName string `json:"name"`
+		}
+		users := make([]jsonUser, 0)
+		err = sharded.QuerySqAll(context.TODO(), squirrel.Select("id", "name").From("users"), func(rows *sqlx.Rows) error {
+			for rows.Next() {
+				var u jsonUser
+				if err := rows.StructScan(&u); err != nil {
+					return err
+				}
+				users = append(users, u)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []jsonUser{{1, "iban"}}, users)
+		require.NoError(t, mockA.ExpectationsWereMet())
+	})
+
+	t.Run("should use the resolver", func(t *testing.T) {
+		sharded := wsqlx.NewShardedRdbms(map[string]wsqlx.RdbmsTx{
+			"a": wsqlx.NewRdbms(sqlx.NewDb(dbMockA, "sqlmock")),
+		}, func(ctx context.Context, shardIDs []string) (string, error) {
+			return "z", nil
+		})
+
+		var name string
+		err = sharded.QueryRowSq(context.TODO(), squirrel.Select("name").From("users"), wsqlx.QueryRowScanTypeDefault, &name)
+		require.ErrorIs(t, err, wsqlx.ErrShardNotFound)
+	})
+}
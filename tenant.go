@@ -0,0 +1,112 @@
+package wsqlx
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrTenantMissing is returned in strict mode for statements executed with a
+// context without tenant.
+var ErrTenantMissing = errors.New("wsqlx: no tenant in context")
+
+// TenantMode defines how the tenant is applied to the Postgres session.
+type TenantMode uint8
+
+const (
+	// TenantModeSchema sets search_path to the schema of the tenant.
+	TenantModeSchema TenantMode = iota + 1
+	// TenantModeSetting sets a setting, app.tenant_id by default, to the tenant
+	// ID, for row-level security policies to read with current_setting.
+	TenantModeSetting
+)
+
+type TenantConfig struct {
+	Mode TenantMode
+	// Schema maps a tenant ID to its schema in TenantModeSchema. The tenant ID
+	// is used as schema when nil.
+	Schema func(tenantID string) string
+	// Setting is the setting of TenantModeSetting, app.tenant_id when empty.
+	Setting string
+	// Strict refuses statements and transactions without tenant in the context
+	// with ErrTenantMissing.
+	Strict bool
+}
+
+// WithTenant applies the tenant set with ContextWithTenant at the start of every
+// transaction, with set_config(..., true), the equivalent of SET LOCAL.
+// Statements outside a transaction run in a transaction of their own, so the
+// setting never outlives the connection checkout. The query cache is disabled,
+// as cached rows can't be told apart by tenant. Postgres only.
+func WithTenant(config TenantConfig) optionFunc {
+	return func(cfg *rdbms) {
+		if config.Setting == "" {
+			config.Setting = "app.tenant_id"
+		}
+		if config.Schema == nil {
+			config.Schema = func(tenantID string) string { return tenantID }
+		}
+		cfg.tenant = &config
+	}
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant sets the tenant of the statements executed with the
+// returned context.
+func ContextWithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenantID, ok := ctx.Value(tenantKey{}).(string)
+	return tenantID, ok && tenantID != ""
+}
+
+func (s *rdbms) guardTenant(ctx context.Context) error {
+	if s.tenant == nil || !s.tenant.Strict {
+		return nil
+	}
+	if _, ok := TenantFromContext(ctx); !ok {
+		return ErrTenantMissing
+	}
+	return nil
+}
+
+// tenantInOwnTx reports whether a statement has to run in a transaction of its
+// own to apply the tenant.
+func (s *rdbms) tenantInOwnTx(ctx context.Context) bool {
+	if s.tenant == nil || s.tx != nil {
+		return false
+	}
+	_, ok := TenantFromContext(ctx)
+	return ok
+}
+
+// beginTenant applies the tenant of ctx to the transaction tx.
+func (s *rdbms) beginTenant(ctx context.Context, tx *sqlx.Tx) error {
+	if s.tenant == nil {
+		return nil
+	}
+
+	tenantID, ok := TenantFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(DBTenantID.String(tenantID))
+
+	setting, value := s.tenant.Setting, tenantID
+	if s.tenant.Mode == TenantModeSchema {
+		setting, value = "search_path", quoteIdentifier(s.tenant.Schema(tenantID))
+	}
+
+	_, err := tx.ExecContext(ctx, "SELECT set_config($1, $2, true)", setting, value)
+	return err
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,73 @@
+package wsqlx_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rdbms_Tenant(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+	ctx := wsqlx.ContextWithTenant(context.TODO(), "acme")
+	setConfig := regexp.QuoteMeta(`SELECT set_config($1, $2, true)`)
+
+	t.Run("should set search_path at the start of the transaction", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithTenant(wsqlx.TenantConfig{
+			Mode:   wsqlx.TenantModeSchema,
+			Schema: func(tenantID string) string { return "tenant_" + tenantID },
+		}))
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setConfig).WithArgs("search_path", `"tenant_acme"`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = ?`)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		err = sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			_, err := tx.ExecSq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+			return err
+		})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run statements outside a transaction in their own transaction", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithTenant(wsqlx.TenantConfig{Mode: wsqlx.TenantModeSetting}))
+
+		mock.ExpectBegin()
+		mock.ExpectExec(setConfig).WithArgs("app.tenant_id", "acme").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM users`)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+		mock.ExpectCommit()
+
+		var count int64
+		err = sqlxx.QueryRowSq(ctx, squirrel.Select("COUNT(*)").From("users"), wsqlx.QueryRowScanTypeDefault, &count)
+		require.NoError(t, err)
+		require.Equal(t, int64(3), count)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should refuse statements without tenant in strict mode", func(t *testing.T) {
+		sqlxx := wsqlx.NewRdbms(sqlxDB, wsqlx.WithTenant(wsqlx.TenantConfig{Mode: wsqlx.TenantModeSetting, Strict: true}))
+
+		var count int64
+		err = sqlxx.QueryRowSq(context.TODO(), squirrel.Select("COUNT(*)").From("users"), wsqlx.QueryRowScanTypeDefault, &count)
+		require.ErrorIs(t, err, wsqlx.ErrTenantMissing)
+
+		err = sqlxx.DoTx(context.TODO(), &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			return nil
+		})
+		require.ErrorIs(t, err, wsqlx.ErrTenantMissing)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
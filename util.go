@@ -4,15 +4,21 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/internal/sqltext"
 	"github.com/jmoiron/sqlx"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 	"reflect"
+	"regexp"
 	"strings"
 )
 
-type callbackRows func(rows *sqlx.Rows) (err error)
+// callbackRows is an alias rather than a defined type, so implementations of
+// Rdbms outside this package, like the decorators in wsqlxtest and wsqlxfault,
+// can spell the callback type as a plain func. It used to be a defined type,
+// see the Upgrading section of the README.
+type callbackRows = func(rows *sqlx.Rows) (err error)
 
 type QueryRowScanType uint8
 
@@ -29,6 +35,15 @@ const (
 	DBQueryParameter   = attribute.Key("db.query.parameter")
 	DBTxIsolationLevel = attribute.Key("db.tx.isolation")
 	DBTxReadOnly       = attribute.Key("db.tx.readonly")
+	DBTxSavepoint      = attribute.Key("db.tx.savepoint")
+	DBCacheHit         = attribute.Key("db.cache.hit")
+	DBCountEstimate    = attribute.Key("db.count.estimate")
+	DBLimiterWait      = attribute.Key("db.limiter.wait_ms")
+	DBTenantID         = attribute.Key("db.tenant.id")
+	DBShardID          = attribute.Key("db.shard.id")
+	DBLockKey          = attribute.Key("db.lock.key")
+	DBLockScope        = attribute.Key("db.lock.scope")
+	DBLockAcquired     = attribute.Key("db.lock.acquired")
 )
 
 func recordError(span trace.Span, err error) {
@@ -55,3 +70,29 @@ func makeParamAttr(args []any) attribute.KeyValue {
 
 	return DBQueryParameter.String(strings.Join(ss, ", "))
 }
+
+// normalizeSQL collapses every run of whitespace into a single space, so
+// statements that differ only in formatting are treated as the same statement.
+func normalizeSQL(stmt string) string {
+	return sqltext.Normalize(stmt)
+}
+
+var tableRegex = regexp.MustCompile("(?i)\\b(?:from|join|update|into)\\s+([`\"\\[]?[\\w.]+[`\"\\]]?)")
+
+// extractTables returns the lower-cased, unquoted table names referenced by stmt
+// after FROM, JOIN, UPDATE and INTO. It is a best-effort scan, not a SQL parser.
+func extractTables(stmt string) []string {
+	matches := tableRegex.FindAllStringSubmatch(stmt, -1)
+	tables := make([]string, 0, len(matches))
+	seen := make(map[string]struct{}, len(matches))
+	for _, match := range matches {
+		table := strings.ToLower(strings.Trim(match[1], "`\"[]"))
+		if _, ok := seen[table]; ok {
+			continue
+		}
+		seen[table] = struct{}{}
+		tables = append(tables, table)
+	}
+
+	return tables
+}
@@ -0,0 +1,100 @@
+package wsqlx
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/lann/builder"
+)
+
+// UnboundedWriteError is returned for an UPDATE or DELETE without a WHERE
+// clause, or with an always true one, when WithUnboundedWriteGuard is enabled.
+type UnboundedWriteError struct {
+	Operation string
+	Table     string
+}
+
+func (e *UnboundedWriteError) Error() string {
+	return fmt.Sprintf("wsqlx: refusing %s on %q without a WHERE clause, see ContextWithUnboundedWrite", e.Operation, e.Table)
+}
+
+// WithUnboundedWriteGuard rejects UPDATE and DELETE statements affecting every
+// row of a table with an *UnboundedWriteError, before they reach the database.
+// Intentional full-table writes have to be run with ContextWithUnboundedWrite.
+func WithUnboundedWriteGuard() optionFunc {
+	return func(cfg *rdbms) {
+		cfg.unboundedWriteGuard = true
+	}
+}
+
+type unboundedWriteKey struct{}
+
+// ContextWithUnboundedWrite allows the statements executed with the returned
+// context to update or delete every row of a table.
+func ContextWithUnboundedWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unboundedWriteKey{}, true)
+}
+
+func (s *rdbms) guardWrite(ctx context.Context, query squirrel.Sqlizer, rawQuery string) error {
+	if !s.unboundedWriteGuard {
+		return nil
+	}
+	if allowed, _ := ctx.Value(unboundedWriteKey{}).(bool); allowed {
+		return nil
+	}
+
+	return checkBoundedWrite(query, rawQuery)
+}
+
+var (
+	whereRegex       = regexp.MustCompile(`(?i)\bWHERE\b`)
+	trueWhereRegex   = regexp.MustCompile(`(?i)\bWHERE\s+\(?\s*(?:1\s*=\s*1|TRUE)\s*\)?\s*(?:$|;|\b(?:RETURNING|ORDER|LIMIT)\b)`)
+	writeTableRegex  = regexp.MustCompile("(?i)^(?:UPDATE|DELETE\\s+FROM)\\s+([`\"\\[]?[\\w.]+[`\"\\]]?)")
+	unboundedWriteOp = map[string]struct{}{"UPDATE": {}, "DELETE": {}}
+)
+
+// checkBoundedWrite inspects the WHERE parts of squirrel update and delete
+// builders, and the SQL of any statement. The SQL check is a best-effort scan
+// of the top-level statement, not a SQL parser.
+func checkBoundedWrite(query squirrel.Sqlizer, rawQuery string) error {
+	switch q := query.(type) {
+	case squirrel.UpdateBuilder:
+		if whereParts, _ := builder.Get(q, "WhereParts"); isEmptySlice(whereParts) {
+			table, _ := builder.Get(q, "Table")
+			return &UnboundedWriteError{Operation: "UPDATE", Table: fmt.Sprint(table)}
+		}
+	case squirrel.DeleteBuilder:
+		if whereParts, _ := builder.Get(q, "WhereParts"); isEmptySlice(whereParts) {
+			table, _ := builder.Get(q, "From")
+			return &UnboundedWriteError{Operation: "DELETE", Table: fmt.Sprint(table)}
+		}
+	}
+
+	stmt := stringLiteralRegex.ReplaceAllString(normalizeSQL(rawQuery), "?")
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return nil
+	}
+	operation := strings.ToUpper(fields[0])
+	if _, ok := unboundedWriteOp[operation]; !ok {
+		return nil
+	}
+
+	if whereRegex.MatchString(stmt) && !trueWhereRegex.MatchString(stmt) {
+		return nil
+	}
+
+	table := ""
+	if match := writeTableRegex.FindStringSubmatch(stmt); match != nil {
+		table = strings.Trim(match[1], "`\"[]")
+	}
+	return &UnboundedWriteError{Operation: operation, Table: table}
+}
+
+func isEmptySlice(value any) bool {
+	parts, _ := value.([]squirrel.Sqlizer)
+	return len(parts) == 0
+}
@@ -0,0 +1,64 @@
+package wsqlx_test
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_rdbms_UnboundedWriteGuard(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"), wsqlx.WithUnboundedWriteGuard())
+	ctx := context.TODO()
+
+	t.Run("should reject unbounded writes", func(t *testing.T) {
+		queries := map[string]squirrel.Sqlizer{
+			"users":    squirrel.Delete("users"),
+			"accounts": squirrel.Update("accounts").Set("balance", 0),
+			"orders":   squirrel.Expr("UPDATE orders SET status = 'paid' WHERE 1=1"),
+			"items":    squirrel.Expr("delete from items"),
+			"carts":    squirrel.Delete("carts").Where(squirrel.And{}),
+		}
+		for table, query := range queries {
+			_, err = sqlxx.ExecSq(ctx, query)
+
+			var unboundedErr *wsqlx.UnboundedWriteError
+			require.True(t, errors.As(err, &unboundedErr), table)
+			require.Equal(t, table, unboundedErr.Table)
+		}
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run bounded writes", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM users WHERE id = ?`)).
+			WithArgs(1).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE orders SET note = 'no where here' WHERE id = 1`)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err = sqlxx.ExecSq(ctx, squirrel.Delete("users").Where(squirrel.Eq{"id": 1}))
+		require.NoError(t, err)
+		_, err = sqlxx.ExecSq(ctx, squirrel.Expr("UPDATE orders SET note = 'no where here' WHERE id = 1"))
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should run unbounded writes when allowed by context", func(t *testing.T) {
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM sessions`)).
+			WillReturnResult(sqlmock.NewResult(0, 10))
+
+		_, err = sqlxx.ExecSq(wsqlx.ContextWithUnboundedWrite(ctx), squirrel.Delete("sessions"))
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+}
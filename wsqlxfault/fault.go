@@ -0,0 +1,334 @@
+// Package wsqlxfault provides an Rdbms and Tx decorator injecting errors and
+// latency, to test how services behave when the database misbehaves.
+package wsqlxfault
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"regexp"
+	"sync/atomic"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Operation is the kind of call a Fault applies to.
+type Operation uint8
+
+const (
+	// OperationQuery covers QuerySq and the pagination queries.
+	OperationQuery Operation = iota + 1
+	OperationQueryRow
+	OperationExec
+	// OperationBegin fails DoTx and DoTxContext before the callback runs.
+	OperationBegin
+	// OperationCommit fails DoTx and DoTxContext after the callback succeeded.
+	// The transaction is rolled back and the fault error is returned.
+	OperationCommit
+)
+
+func (o Operation) String() string {
+	switch o {
+	case OperationQuery:
+		return "query"
+	case OperationQueryRow:
+		return "query_row"
+	case OperationExec:
+		return "exec"
+	case OperationBegin:
+		return "begin"
+	case OperationCommit:
+		return "commit"
+	default:
+		return "unknown"
+	}
+}
+
+// Fault describes when and how a call fails.
+type Fault struct {
+	// Operations the fault applies to, all operations when empty.
+	Operations []Operation
+	// SQL restricts the fault to statements matching it. Begin and commit have
+	// no statement, so a fault with SQL set never applies to them.
+	SQL *regexp.Regexp
+	// Probability of the fault applying to a matching call (0 to 1). Zero
+	// means always.
+	Probability float64
+	// Latency delays the call. A call whose context ends while it is delayed
+	// returns the context error, which simulates timeouts.
+	Latency time.Duration
+	// Err is returned instead of running the call. With a nil Err the call
+	// runs after Latency.
+	Err error
+}
+
+func (f Fault) matches(op Operation, stmts []string) bool {
+	if len(f.Operations) > 0 {
+		found := false
+		for _, o := range f.Operations {
+			if o == op {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.SQL == nil {
+		return true
+	}
+	for _, stmt := range stmts {
+		if f.SQL.MatchString(stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config configures an Injector.
+type Config struct {
+	// Faults are evaluated in order, the first one that applies is injected.
+	Faults []Fault
+	// Rand returns a number in [0, 1) used for Probability. math/rand is used
+	// when nil, pass a seeded source for reproducible runs.
+	Rand func() float64
+}
+
+// DB is both an Rdbms and a Tx, like the value returned by wsqlx.NewRdbms.
+type DB interface {
+	wsqlx.Rdbms
+	wsqlx.Tx
+}
+
+// Injector decorates a DB with the configured faults. It can be turned off and
+// on at runtime, e.g. from an admin endpoint in staging.
+type Injector struct {
+	db       DB
+	config   Config
+	disabled atomic.Bool
+	injected atomic.Int64
+}
+
+var _ DB = (*Injector)(nil)
+
+// New returns an enabled Injector decorating db.
+func New(db DB, config Config) *Injector {
+	if config.Rand == nil {
+		config.Rand = rand.Float64
+	}
+
+	return &Injector{db: db, config: config}
+}
+
+// SetEnabled turns fault injection on or off.
+func (i *Injector) SetEnabled(enabled bool) {
+	i.disabled.Store(!enabled)
+}
+
+// Injected returns the number of faults injected so far.
+func (i *Injector) Injected() int64 {
+	return i.injected.Load()
+}
+
+// inject applies the first matching fault to the call. A non-nil error means
+// the call must not run.
+func (i *Injector) inject(ctx context.Context, op Operation, queries ...squirrel.Sqlizer) error {
+	if i.disabled.Load() {
+		return nil
+	}
+
+	stmts := make([]string, 0, len(queries))
+	for _, query := range queries {
+		stmt, _, err := query.ToSql()
+		if err == nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	for _, fault := range i.config.Faults {
+		if !fault.matches(op, stmts) {
+			continue
+		}
+		if fault.Probability > 0 && i.config.Rand() >= fault.Probability {
+			continue
+		}
+
+		i.injected.Add(1)
+		trace.SpanFromContext(ctx).AddEvent("db.fault_injected", trace.WithAttributes(
+			attribute.String("db.fault.operation", op.String()),
+			attribute.Int64("db.fault.latency_ms", fault.Latency.Milliseconds()),
+			attribute.Bool("db.fault.error", fault.Err != nil),
+		))
+
+		if fault.Latency > 0 {
+			timer := time.NewTimer(fault.Latency)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+		return fault.Err
+	}
+
+	return nil
+}
+
+func (i *Injector) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	return querySq(ctx, i, i.db, query, callback)
+}
+
+func (i *Injector) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return querySqPagination(ctx, i, i.db, countQuery, query, pagination, callback)
+}
+
+func (i *Injector) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return querySqPaginationAuto(ctx, i, i.db, query, pagination, strategy, callback)
+}
+
+func (i *Injector) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationNoCountOutput, error) {
+	return querySqPaginationNoCount(ctx, i, i.db, query, pagination, callback)
+}
+
+func (i *Injector) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+	return queryRowSq(ctx, i, i.db, query, scanType, dest)
+}
+
+func (i *Injector) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error) {
+	return execSq(ctx, i, i.db, query)
+}
+
+// Unwrap returns the wrapped DB, for wsqlx.LockTx.
+func (i *Injector) Unwrap() wsqlx.Rdbms {
+	return i.db
+}
+
+func (i *Injector) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx wsqlx.Rdbms) error) error {
+	return i.DoTxContext(ctx, opt, func(_ context.Context, tx wsqlx.Rdbms) error {
+		return fn(tx)
+	})
+}
+
+func (i *Injector) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) error {
+	return doTx(ctx, i, i.db, opt, fn)
+}
+
+// txRdbms is the Rdbms passed to DoTx callbacks, so faults also hit the
+// statements of a transaction and of its nested savepoints.
+type txRdbms struct {
+	injector *Injector
+	rdbms    wsqlx.Rdbms
+	tx       wsqlx.Tx
+}
+
+var _ wsqlx.Tx = (*txRdbms)(nil)
+
+// Unwrap returns the transaction, for wsqlx.LockTx.
+func (t *txRdbms) Unwrap() wsqlx.Rdbms {
+	return t.rdbms
+}
+
+func (t *txRdbms) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx wsqlx.Rdbms) error) error {
+	return t.DoTxContext(ctx, opt, func(_ context.Context, tx wsqlx.Rdbms) error {
+		return fn(tx)
+	})
+}
+
+func (t *txRdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) error {
+	if t.tx == nil {
+		return errors.New("wsqlxfault: the transaction does not support nested transactions")
+	}
+	return doTx(ctx, t.injector, t.tx, opt, fn)
+}
+
+func (t *txRdbms) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	return querySq(ctx, t.injector, t.rdbms, query, callback)
+}
+
+func (t *txRdbms) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return querySqPagination(ctx, t.injector, t.rdbms, countQuery, query, pagination, callback)
+}
+
+func (t *txRdbms) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return querySqPaginationAuto(ctx, t.injector, t.rdbms, query, pagination, strategy, callback)
+}
+
+func (t *txRdbms) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationNoCountOutput, error) {
+	return querySqPaginationNoCount(ctx, t.injector, t.rdbms, query, pagination, callback)
+}
+
+func (t *txRdbms) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+	return queryRowSq(ctx, t.injector, t.rdbms, query, scanType, dest)
+}
+
+func (t *txRdbms) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error) {
+	return execSq(ctx, t.injector, t.rdbms, query)
+}
+
+func doTx(ctx context.Context, i *Injector, db wsqlx.Tx, opt *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) error {
+	if err := i.inject(ctx, OperationBegin); err != nil {
+		return err
+	}
+
+	return db.DoTxContext(ctx, opt, func(ctx context.Context, tx wsqlx.Rdbms) error {
+		nested, _ := tx.(wsqlx.Tx)
+		if err := fn(ctx, &txRdbms{injector: i, rdbms: tx, tx: nested}); err != nil {
+			return err
+		}
+
+		// Failing after the callback makes the real transaction roll back, which
+		// is what the caller observes when COMMIT fails.
+		return i.inject(ctx, OperationCommit)
+	})
+}
+
+func querySq(ctx context.Context, i *Injector, rdbms wsqlx.Rdbms, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	if err := i.inject(ctx, OperationQuery, query); err != nil {
+		return err
+	}
+	return rdbms.QuerySq(ctx, query, callback)
+}
+
+func querySqPagination(ctx context.Context, i *Injector, rdbms wsqlx.Rdbms, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	if err := i.inject(ctx, OperationQuery, countQuery, query); err != nil {
+		return wsqlx.PaginationOutput{}, err
+	}
+	return rdbms.QuerySqPagination(ctx, countQuery, query, pagination, callback)
+}
+
+func querySqPaginationAuto(ctx context.Context, i *Injector, rdbms wsqlx.Rdbms, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	if err := i.inject(ctx, OperationQuery, query); err != nil {
+		return wsqlx.PaginationOutput{}, err
+	}
+	return rdbms.QuerySqPaginationAuto(ctx, query, pagination, strategy, callback)
+}
+
+func querySqPaginationNoCount(ctx context.Context, i *Injector, rdbms wsqlx.Rdbms, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationNoCountOutput, error) {
+	if err := i.inject(ctx, OperationQuery, query); err != nil {
+		return wsqlx.PaginationNoCountOutput{}, err
+	}
+	return rdbms.QuerySqPaginationNoCount(ctx, query, pagination, callback)
+}
+
+func queryRowSq(ctx context.Context, i *Injector, rdbms wsqlx.Rdbms, query squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+	if err := i.inject(ctx, OperationQueryRow, query); err != nil {
+		return err
+	}
+	return rdbms.QueryRowSq(ctx, query, scanType, dest)
+}
+
+func execSq(ctx context.Context, i *Injector, rdbms wsqlx.Rdbms, query squirrel.Sqlizer) (sql.Result, error) {
+	if err := i.inject(ctx, OperationExec, query); err != nil {
+		return nil, err
+	}
+	return rdbms.ExecSq(ctx, query)
+}
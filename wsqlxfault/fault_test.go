@@ -0,0 +1,138 @@
+package wsqlxfault_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxfault"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest/wsqlxsqlite"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Injector(t *testing.T) {
+	ctx := context.TODO()
+	errInjected := errors.New("injected")
+	schema := `CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`
+
+	t.Run("should fail matching statements only", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{schema})
+		db := wsqlxfault.New(fake, wsqlxfault.Config{Faults: []wsqlxfault.Fault{{
+			Operations: []wsqlxfault.Operation{wsqlxfault.OperationExec},
+			SQL:        regexp.MustCompile(`^DELETE`),
+			Err:        errInjected,
+		}}})
+
+		_, err := db.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban"))
+		require.NoError(t, err)
+
+		_, err = db.ExecSq(ctx, squirrel.Delete("users"))
+		require.ErrorIs(t, err, errInjected)
+		fake.AssertCount("users", nil, 1)
+		require.Equal(t, int64(1), db.Injected())
+
+		db.SetEnabled(false)
+		_, err = db.ExecSq(ctx, squirrel.Delete("users"))
+		require.NoError(t, err)
+		fake.AssertCount("users", nil, 0)
+	})
+
+	t.Run("should roll back when commit fails", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{schema})
+		db := wsqlxfault.New(fake, wsqlxfault.Config{Faults: []wsqlxfault.Fault{{
+			Operations: []wsqlxfault.Operation{wsqlxfault.OperationCommit},
+			Err:        errInjected,
+		}}})
+
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			_, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban"))
+			return err
+		})
+		require.ErrorIs(t, err, errInjected)
+		fake.AssertCount("users", nil, 0)
+	})
+
+	t.Run("should inject faults inside transactions", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{schema})
+		db := wsqlxfault.New(fake, wsqlxfault.Config{Faults: []wsqlxfault.Fault{{
+			Operations: []wsqlxfault.Operation{wsqlxfault.OperationQueryRow},
+			Err:        errInjected,
+		}}})
+
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			if _, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban")); err != nil {
+				return err
+			}
+			var name string
+			return tx.QueryRowSq(ctx, squirrel.Select("name").From("users"), wsqlx.QueryRowScanTypeDefault, &name)
+		})
+		require.ErrorIs(t, err, errInjected)
+		fake.AssertCount("users", nil, 0)
+	})
+
+	t.Run("should inject faults inside nested transactions", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{schema})
+		db := wsqlxfault.New(fake, wsqlxfault.Config{Faults: []wsqlxfault.Fault{{
+			Operations: []wsqlxfault.Operation{wsqlxfault.OperationQueryRow},
+			Err:        errInjected,
+		}}})
+
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			if _, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban")); err != nil {
+				return err
+			}
+
+			err := tx.(wsqlx.Tx).DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+				if _, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("rama")); err != nil {
+					return err
+				}
+				var name string
+				return tx.QueryRowSq(ctx, squirrel.Select("name").From("users"), wsqlx.QueryRowScanTypeDefault, &name)
+			})
+			require.ErrorIs(t, err, errInjected)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(1), db.Injected())
+		fake.AssertCount("users", nil, 1)
+		fake.AssertExists("users", squirrel.Eq{"name": "iban"})
+	})
+
+	t.Run("should time out on latency", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{schema})
+		db := wsqlxfault.New(fake, wsqlxfault.Config{Faults: []wsqlxfault.Fault{{
+			Latency: time.Second,
+		}}})
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+
+		var count int
+		err := db.QueryRowSq(ctx, squirrel.Select("COUNT(*)").From("users"), wsqlx.QueryRowScanTypeDefault, &count)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("should apply probability", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{schema})
+		rolls := []float64{0.9, 0.1}
+		db := wsqlxfault.New(fake, wsqlxfault.Config{
+			Faults: []wsqlxfault.Fault{{Probability: 0.5, Err: errInjected}},
+			Rand: func() float64 {
+				roll := rolls[0]
+				rolls = rolls[1:]
+				return roll
+			},
+		})
+
+		query := squirrel.Insert("users").Columns("name").Values("iban")
+		_, err := db.ExecSq(ctx, query)
+		require.NoError(t, err)
+		_, err = db.ExecSq(ctx, query)
+		require.ErrorIs(t, err, errInjected)
+	})
+}
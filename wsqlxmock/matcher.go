@@ -0,0 +1,151 @@
+// Package wsqlxmock provides helpers for testing code that uses the generated
+// wsqlx mocks.
+package wsqlxmock
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/internal/sqltext"
+	"go.uber.org/mock/gomock"
+)
+
+// NormalizeSQL collapses whitespace and rewrites numbered placeholders ($1,
+// @p1, :1) to '?', so expectations don't depend on formatting or on the
+// placeholder format of the builder.
+func NormalizeSQL(stmt string) string {
+	stmt = sqltext.NumberedPlaceholderRegex.ReplaceAllString(stmt, "?")
+	return strings.TrimSuffix(sqltext.Normalize(stmt), ";")
+}
+
+// SQLEq matches a squirrel.Sqlizer whose normalized SQL equals stmt and whose
+// arguments equal args.
+//
+//	mock.EXPECT().QueryRowSq(gomock.Any(), wsqlxmock.SQLEq("SELECT name FROM users WHERE id = ?", 1), gomock.Any(), gomock.Any())
+func SQLEq(stmt string, args ...any) gomock.Matcher {
+	stmt = NormalizeSQL(stmt)
+	return &sqlMatcher{
+		desc:      fmt.Sprintf("SQL equal to %q with args %v", stmt, args),
+		want:      stmt,
+		matchSQL:  func(got string) bool { return got == stmt },
+		args:      args,
+		checkArgs: true,
+	}
+}
+
+// SQLRegex matches a squirrel.Sqlizer whose normalized SQL matches pattern.
+// The arguments are compared only when args are given.
+func SQLRegex(pattern string, args ...any) gomock.Matcher {
+	re := regexp.MustCompile(pattern)
+	return &sqlMatcher{
+		desc:      fmt.Sprintf("SQL matching /%s/", pattern) + argsDesc(args),
+		matchSQL:  re.MatchString,
+		args:      args,
+		checkArgs: len(args) > 0,
+	}
+}
+
+// SQLContains matches a squirrel.Sqlizer whose normalized SQL contains substr.
+// The arguments are compared only when args are given.
+func SQLContains(substr string, args ...any) gomock.Matcher {
+	substr = NormalizeSQL(substr)
+	return &sqlMatcher{
+		desc:      fmt.Sprintf("SQL containing %q", substr) + argsDesc(args),
+		matchSQL:  func(got string) bool { return strings.Contains(got, substr) },
+		args:      args,
+		checkArgs: len(args) > 0,
+	}
+}
+
+func argsDesc(args []any) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" with args %v", args)
+}
+
+type sqlMatcher struct {
+	desc      string
+	want      string
+	matchSQL  func(got string) bool
+	args      []any
+	checkArgs bool
+}
+
+func (m *sqlMatcher) Matches(x any) bool {
+	stmt, args, err := toSQL(x)
+	if err != nil || !m.matchSQL(stmt) {
+		return false
+	}
+
+	return !m.checkArgs || argsEqual(m.args, args)
+}
+
+func (m *sqlMatcher) String() string {
+	return m.desc
+}
+
+// Got implements gomock.GotFormatter, printing the SQL the code under test
+// built and, for SQLEq, where it diverges from the expectation.
+func (m *sqlMatcher) Got(got any) string {
+	stmt, args, err := toSQL(got)
+	if err != nil {
+		return fmt.Sprintf("%v (%v)", got, err)
+	}
+
+	s := fmt.Sprintf("SQL %q with args %v", stmt, args)
+	if m.want != "" && m.want != stmt {
+		i := 0
+		for i < len(stmt) && i < len(m.want) && stmt[i] == m.want[i] {
+			i++
+		}
+		s += fmt.Sprintf("\n\tSQL diverges at offset %d: got %q, want %q", i, stmt[i:], m.want[i:])
+	}
+
+	return s
+}
+
+func toSQL(x any) (string, []any, error) {
+	sqlizer, ok := x.(squirrel.Sqlizer)
+	if !ok {
+		return "", nil, fmt.Errorf("%T is not a squirrel.Sqlizer", x)
+	}
+
+	stmt, args, err := sqlizer.ToSql()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return NormalizeSQL(stmt), args, nil
+}
+
+// argsEqual compares arguments by their driver values, so int(1) equals int64(1).
+func argsEqual(want, got []any) bool {
+	if len(want) != len(got) {
+		return false
+	}
+
+	for i := range want {
+		if m, ok := want[i].(gomock.Matcher); ok {
+			if !m.Matches(got[i]) {
+				return false
+			}
+			continue
+		}
+
+		w, errW := driver.DefaultParameterConverter.ConvertValue(want[i])
+		g, errG := driver.DefaultParameterConverter.ConvertValue(got[i])
+		if errW != nil || errG != nil {
+			w, g = want[i], got[i]
+		}
+		if !reflect.DeepEqual(w, g) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,35 @@
+package wsqlxmock_test
+
+import (
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxmock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_SQLMatchers(t *testing.T) {
+	query := squirrel.Select("id", "name").From("users").
+		Where(squirrel.Eq{"id": 1}).
+		PlaceholderFormat(squirrel.Dollar)
+
+	t.Run("should match normalized SQL and args", func(t *testing.T) {
+		require.True(t, wsqlxmock.SQLEq(`SELECT id, name
+			FROM users WHERE id = ?`, int64(1)).Matches(query))
+		require.False(t, wsqlxmock.SQLEq("SELECT id, name FROM users WHERE id = ?", 2).Matches(query))
+		require.True(t, wsqlxmock.SQLEq("SELECT id, name FROM users WHERE id = ?", gomock.Any()).Matches(query))
+	})
+
+	t.Run("should match SQL by regex and substring", func(t *testing.T) {
+		require.True(t, wsqlxmock.SQLRegex(`^SELECT .* FROM users`).Matches(query))
+		require.True(t, wsqlxmock.SQLContains("WHERE id = ?", 1).Matches(query))
+		require.False(t, wsqlxmock.SQLContains("ORDER BY").Matches(query))
+	})
+
+	t.Run("should describe where SQL diverges", func(t *testing.T) {
+		matcher := wsqlxmock.SQLEq("SELECT id, name FROM accounts WHERE id = ?", 1)
+		got := matcher.(gomock.GotFormatter).Got(query)
+		require.Contains(t, got, `got "users WHERE id = ?", want "accounts WHERE id = ?"`)
+	})
+}
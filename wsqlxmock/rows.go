@@ -0,0 +1,178 @@
+package wsqlxmock
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/internal/staticrows"
+	"github.com/jmoiron/sqlx"
+)
+
+// Rows is a declared result set returned by a mock expectation.
+type Rows struct {
+	columns []string
+	values  [][]any
+	err     error
+}
+
+// NewRows returns an empty result set with the given columns.
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns, values: make([][]any, 0)}
+}
+
+// NewRowsFromStructs returns a result set with one row per element of items, a
+// slice of structs or struct pointers. Columns are named after the db tags of
+// the fields, falling back to the lower-cased field name like sqlx does.
+func NewRowsFromStructs(items any) *Rows {
+	v := reflect.ValueOf(items)
+	if v.Kind() != reflect.Slice {
+		return &Rows{err: fmt.Errorf("wsqlxmock: %T is not a slice", items)}
+	}
+
+	t := v.Type().Elem()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return &Rows{err: fmt.Errorf("wsqlxmock: %T is not a slice of structs", items)}
+	}
+
+	columns, paths := structColumns(t, nil)
+	rows := NewRows(columns...)
+	for i := 0; i < v.Len(); i++ {
+		item := reflect.Indirect(v.Index(i))
+		values := make([]any, len(paths))
+		for j, path := range paths {
+			values[j] = item.FieldByIndex(path).Interface()
+		}
+		rows.AddRow(values...)
+	}
+
+	return rows
+}
+
+func structColumns(t reflect.Type, parent []int) ([]string, [][]int) {
+	columns := make([]string, 0)
+	paths := make([][]int, 0)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		path := append(append([]int{}, parent...), i)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			c, p := structColumns(field.Type, path)
+			columns = append(columns, c...)
+			paths = append(paths, p...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("db"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		columns = append(columns, name)
+		paths = append(paths, path)
+	}
+
+	return columns, paths
+}
+
+// AddRow appends a row. Values are converted like query arguments, so Go
+// types such as int or sql.NullString can be used directly.
+func (r *Rows) AddRow(values ...any) *Rows {
+	if r.err != nil {
+		return r
+	}
+	if len(values) != len(r.columns) {
+		r.err = fmt.Errorf("wsqlxmock: row has %d values, expected %d columns", len(values), len(r.columns))
+		return r
+	}
+
+	row := make([]any, len(values))
+	for i, value := range values {
+		converted, err := driver.DefaultParameterConverter.ConvertValue(value)
+		if err != nil {
+			r.err = fmt.Errorf("wsqlxmock: column %s: %w", r.columns[i], err)
+			return r
+		}
+		row[i] = converted
+	}
+	r.values = append(r.values, row)
+
+	return r
+}
+
+// static returns the result set to serve, or the error of its declaration.
+func (r *Rows) static() (*staticrows.Rows, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return &staticrows.Rows{Columns: r.columns, Values: r.values}, nil
+}
+
+func (r *Rows) callback(ctx context.Context, callback func(rows *sqlx.Rows) error) error {
+	static, err := r.static()
+	if err != nil {
+		return err
+	}
+
+	res, err := static.Query(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	return callback(res)
+}
+
+// QuerySq returns a function for DoAndReturn of MockRdbms.QuerySq, which runs
+// the callback of the code under test over rows.
+//
+//	rdbmsMock.EXPECT().QuerySq(gomock.Any(), gomock.Any(), gomock.Any()).
+//		DoAndReturn(wsqlxmock.QuerySq(wsqlxmock.NewRows("id", "name").AddRow(1, "iban")))
+func QuerySq(rows *Rows) func(ctx context.Context, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	return func(ctx context.Context, _ squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+		return rows.callback(ctx, callback)
+	}
+}
+
+// QuerySqPagination returns a function for DoAndReturn of
+// MockRdbms.QuerySqPagination, which runs the callback over rows and reports
+// totalData as the total count.
+func QuerySqPagination(rows *Rows, totalData int64) func(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return func(ctx context.Context, _, _ squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+		if err := rows.callback(ctx, callback); err != nil {
+			return wsqlx.PaginationOutput{}, err
+		}
+
+		return wsqlx.CreatePaginationOutput(pagination, totalData), nil
+	}
+}
+
+// QueryRowSq returns a function for DoAndReturn of MockRdbms.QueryRowSq, which
+// scans the first row of rows into dest according to the scan type. An empty
+// result set returns sql.ErrNoRows.
+func QueryRowSq(rows *Rows) func(ctx context.Context, query squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+	return func(ctx context.Context, _ squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+		static, err := rows.static()
+		if err != nil {
+			return err
+		}
+
+		row := static.QueryRow(ctx, nil)
+		if scanType == wsqlx.QueryRowScanTypeStruct {
+			return row.StructScan(dest)
+		}
+		return row.Scan(dest)
+	}
+}
@@ -0,0 +1,83 @@
+package wsqlxmock_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type user struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func Test_MockRows(t *testing.T) {
+	ctx := context.TODO()
+	ctrl := gomock.NewController(t)
+	rdbmsMock := wsqlx.NewMockRdbms(ctrl)
+
+	t.Run("should run QuerySq callback over declared rows", func(t *testing.T) {
+		rdbmsMock.EXPECT().
+			QuerySq(gomock.Any(), wsqlxmock.SQLEq("SELECT id, name FROM users"), gomock.Any()).
+			DoAndReturn(wsqlxmock.QuerySq(wsqlxmock.NewRowsFromStructs([]user{{ID: 1, Name: "iban"}, {ID: 2, Name: "rama"}})))
+
+		users := make([]user, 0)
+		err := rdbmsMock.QuerySq(ctx, squirrel.Select("id", "name").From("users"), func(rows *sqlx.Rows) (err error) {
+			for rows.Next() {
+				var u user
+				if err = rows.StructScan(&u); err != nil {
+					return err
+				}
+				users = append(users, u)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []user{{ID: 1, Name: "iban"}, {ID: 2, Name: "rama"}}, users)
+	})
+
+	t.Run("should fill QueryRowSq dest for both scan types", func(t *testing.T) {
+		rdbmsMock.EXPECT().
+			QueryRowSq(gomock.Any(), gomock.Any(), wsqlx.QueryRowScanTypeStruct, gomock.Any()).
+			DoAndReturn(wsqlxmock.QueryRowSq(wsqlxmock.NewRows("id", "name").AddRow(1, "iban")))
+		rdbmsMock.EXPECT().
+			QueryRowSq(gomock.Any(), gomock.Any(), wsqlx.QueryRowScanTypeDefault, gomock.Any()).
+			DoAndReturn(wsqlxmock.QueryRowSq(wsqlxmock.NewRows("count").AddRow(7)))
+		rdbmsMock.EXPECT().
+			QueryRowSq(gomock.Any(), gomock.Any(), wsqlx.QueryRowScanTypeDefault, gomock.Any()).
+			DoAndReturn(wsqlxmock.QueryRowSq(wsqlxmock.NewRows("count")))
+
+		var u user
+		err := rdbmsMock.QueryRowSq(ctx, squirrel.Select("id", "name").From("users"), wsqlx.QueryRowScanTypeStruct, &u)
+		require.NoError(t, err)
+		require.Equal(t, user{ID: 1, Name: "iban"}, u)
+
+		var count int
+		err = rdbmsMock.QueryRowSq(ctx, squirrel.Select("COUNT(*)").From("users"), wsqlx.QueryRowScanTypeDefault, &count)
+		require.NoError(t, err)
+		require.Equal(t, 7, count)
+
+		err = rdbmsMock.QueryRowSq(ctx, squirrel.Select("COUNT(*)").From("users"), wsqlx.QueryRowScanTypeDefault, &count)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("should return pagination output with declared total", func(t *testing.T) {
+		rdbmsMock.EXPECT().
+			QuerySqPagination(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+			DoAndReturn(wsqlxmock.QuerySqPagination(wsqlxmock.NewRows("id").AddRow(1), 11))
+
+		output, err := rdbmsMock.QuerySqPagination(ctx, squirrel.Select("COUNT(*)").From("users"), squirrel.Select("id").From("users"),
+			wsqlx.PaginationInput{Page: 1, PageSize: 10}, func(rows *sqlx.Rows) error {
+				return nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), output.PageCount)
+	})
+}
@@ -0,0 +1,126 @@
+package wsqlxmock
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+)
+
+type TxOutcome uint8
+
+const (
+	TxOutcomeNotStarted TxOutcome = iota + 1
+	TxOutcomeCommitted
+	TxOutcomeRolledBack
+)
+
+func (o TxOutcome) String() string {
+	switch o {
+	case TxOutcomeNotStarted:
+		return "not started"
+	case TxOutcomeCommitted:
+		return "committed"
+	case TxOutcomeRolledBack:
+		return "rolled back"
+	default:
+		return "unknown"
+	}
+}
+
+// TxCall records one DoTx or DoTxContext call of a FakeTx.
+type TxCall struct {
+	Options *sql.TxOptions
+	Outcome TxOutcome
+	// Err is the error returned to the caller.
+	Err error
+	// Panic is the value the callback panicked with, if it did.
+	Panic any
+}
+
+// FakeTx is a wsqlx.Tx running the callback with Rdbms, which can be a
+// MockRdbms or any fake. It follows the commit and rollback rules of the real
+// implementation and records the outcome of every call.
+type FakeTx struct {
+	Rdbms wsqlx.Rdbms
+
+	// BeginErr, CommitErr and RollbackErr simulate failures of the matching
+	// transaction step.
+	BeginErr    error
+	CommitErr   error
+	RollbackErr error
+
+	mu    sync.Mutex
+	calls []TxCall
+}
+
+var _ wsqlx.Tx = (*FakeTx)(nil)
+
+// NewFakeTx returns a FakeTx passing rdbms to the callbacks.
+func NewFakeTx(rdbms wsqlx.Rdbms) *FakeTx {
+	return &FakeTx{Rdbms: rdbms}
+}
+
+func (f *FakeTx) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx wsqlx.Rdbms) error) error {
+	return f.DoTxContext(ctx, opt, func(_ context.Context, tx wsqlx.Rdbms) error {
+		return fn(tx)
+	})
+}
+
+func (f *FakeTx) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) (err error) {
+	call := TxCall{Options: opt}
+	defer func() {
+		call.Err = err
+		f.mu.Lock()
+		f.calls = append(f.calls, call)
+		f.mu.Unlock()
+	}()
+
+	if f.BeginErr != nil {
+		call.Outcome = TxOutcomeNotStarted
+		return f.BeginErr
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			call.Outcome = TxOutcomeRolledBack
+			call.Panic = p
+			panic(p)
+		}
+	}()
+
+	if err = fn(ctx, f.Rdbms); err != nil {
+		call.Outcome = TxOutcomeRolledBack
+		if f.RollbackErr != nil {
+			err = errors.Join(err, f.RollbackErr)
+		}
+		return err
+	}
+
+	if f.CommitErr != nil {
+		call.Outcome = TxOutcomeRolledBack
+		return f.CommitErr
+	}
+
+	call.Outcome = TxOutcomeCommitted
+	return nil
+}
+
+// Calls returns the recorded calls in order.
+func (f *FakeTx) Calls() []TxCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]TxCall(nil), f.calls...)
+}
+
+// LastCall returns the most recent call, or false if there was none.
+func (f *FakeTx) LastCall() (TxCall, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.calls) == 0 {
+		return TxCall{}, false
+	}
+	return f.calls[len(f.calls)-1], true
+}
@@ -0,0 +1,70 @@
+package wsqlxmock_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxmock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_FakeTx(t *testing.T) {
+	ctx := context.TODO()
+	rdbmsMock := wsqlx.NewMockRdbms(gomock.NewController(t))
+
+	t.Run("should commit and pass the rdbms to the callback", func(t *testing.T) {
+		fakeTx := wsqlxmock.NewFakeTx(rdbmsMock)
+
+		err := fakeTx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			require.Equal(t, rdbmsMock, tx)
+			return nil
+		})
+		require.NoError(t, err)
+
+		call, ok := fakeTx.LastCall()
+		require.True(t, ok)
+		require.Equal(t, wsqlxmock.TxOutcomeCommitted, call.Outcome)
+	})
+
+	t.Run("should roll back on commit failure", func(t *testing.T) {
+		fakeTx := wsqlxmock.NewFakeTx(rdbmsMock)
+		fakeTx.CommitErr = errors.New("commit failed")
+
+		err := fakeTx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			return nil
+		})
+		require.ErrorIs(t, err, fakeTx.CommitErr)
+
+		call, _ := fakeTx.LastCall()
+		require.Equal(t, wsqlxmock.TxOutcomeRolledBack, call.Outcome)
+	})
+
+	t.Run("should not run the callback on begin failure", func(t *testing.T) {
+		fakeTx := wsqlxmock.NewFakeTx(rdbmsMock)
+		fakeTx.BeginErr = errors.New("begin failed")
+
+		err := fakeTx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			t.Fatal("callback must not run")
+			return nil
+		})
+		require.ErrorIs(t, err, fakeTx.BeginErr)
+	})
+
+	t.Run("should record panic and roll back", func(t *testing.T) {
+		fakeTx := wsqlxmock.NewFakeTx(rdbmsMock)
+
+		require.Panics(t, func() {
+			_ = fakeTx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+				panic("boom")
+			})
+		})
+
+		call, _ := fakeTx.LastCall()
+		require.Equal(t, wsqlxmock.TxOutcomeRolledBack, call.Outcome)
+		require.Equal(t, "boom", call.Panic)
+	})
+}
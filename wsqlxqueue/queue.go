@@ -0,0 +1,441 @@
+// Package wsqlxqueue is a durable job queue stored in a Postgres table, built
+// on wsqlx. Workers claim jobs with SELECT ... FOR UPDATE SKIP LOCKED, so any
+// number of them can poll the same queue without blocking each other. Only
+// Postgres is supported: the statements use $n placeholders and RETURNING.
+package wsqlxqueue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrJobLost is returned by Complete and Fail when the job was claimed again
+// by another worker after its visibility timeout expired.
+var ErrJobLost = errors.New("wsqlxqueue: job was claimed by another worker")
+
+const (
+	StatusPending = "pending"
+	StatusDead    = "dead"
+)
+
+// Job is a claimed job. Attempts includes the current attempt. LockedUntil is
+// the end of its visibility timeout, after which it can be claimed again.
+type Job struct {
+	ID          int64
+	Queue       string
+	Payload     []byte
+	Attempts    int
+	MaxAttempts int
+	RunAt       time.Time
+	LockedUntil time.Time
+	CreatedAt   time.Time
+
+	traceParent string
+}
+
+type Config struct {
+	// Table holding the jobs, wsqlx_jobs when empty.
+	Table string
+	// Queue is the name of the queue within Table, default when empty.
+	Queue string
+	// BatchSize is the number of jobs claimed at once, 10 when zero.
+	BatchSize int
+	// VisibilityTimeout is how long a claimed job stays invisible to the other
+	// workers. A job not completed or failed in time is claimed again, its
+	// handler context ends with the timeout. 5 minutes when zero.
+	VisibilityTimeout time.Duration
+	// MaxAttempts moves a job to StatusDead once it failed or timed out that
+	// many times, 5 when zero.
+	MaxAttempts int
+	// Backoff returns the delay before the next attempt of a job that failed
+	// attempt times. It doubles from one second up to an hour when nil.
+	Backoff func(attempt int) time.Duration
+	// PollInterval is how long Work waits after finding no job, 1 second when zero.
+	PollInterval time.Duration
+	// Logger receives the errors Work recovers from. slog.Default is used when nil.
+	Logger *slog.Logger
+	// Now returns the current time, time.Now when nil.
+	Now func() time.Time
+	// TracerProvider creates the tracer of the queue spans, the global one when
+	// nil.
+	TracerProvider trace.TracerProvider
+}
+
+func defaultBackoff(attempt int) time.Duration {
+	backoff := time.Second << min(max(attempt-1, 0), 12)
+	return min(backoff, time.Hour)
+}
+
+type Queue struct {
+	db     wsqlx.Rdbms
+	config Config
+	tracer trace.Tracer
+}
+
+// New returns the queue config.Queue stored in db.
+func New(db wsqlx.Rdbms, config Config) *Queue {
+	if config.Table == "" {
+		config.Table = "wsqlx_jobs"
+	}
+	if config.Queue == "" {
+		config.Queue = "default"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 10
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = 5 * time.Minute
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.Backoff == nil {
+		config.Backoff = defaultBackoff
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+
+	return &Queue{
+		db:     db,
+		config: config,
+		tracer: config.TracerProvider.Tracer(wsqlx.TracerName),
+	}
+}
+
+// CreateSchema creates the table of the queue and its claim index, if they
+// don't exist.
+func (q *Queue) CreateSchema(ctx context.Context) error {
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id BIGSERIAL PRIMARY KEY,
+	queue TEXT NOT NULL,
+	payload BYTEA NOT NULL,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INT NOT NULL DEFAULT 0,
+	max_attempts INT NOT NULL,
+	run_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ,
+	last_error TEXT,
+	trace_parent TEXT,
+	created_at TIMESTAMPTZ NOT NULL
+)`, q.config.Table),
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %[1]s_claim_idx ON %[1]s (queue, run_at) WHERE status = 'pending'`, q.config.Table),
+	}
+
+	for _, stmt := range statements {
+		if _, err := q.db.ExecSq(ctx, squirrel.Expr(stmt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Enqueue adds a job to run now. Pass the Rdbms of a DoTx callback as db to
+// enqueue within that transaction, or nil to use the database of the queue.
+func (q *Queue) Enqueue(ctx context.Context, db wsqlx.Rdbms, payload []byte) (int64, error) {
+	return q.EnqueueAt(ctx, db, payload, q.config.Now())
+}
+
+// EnqueueAt adds a job to run at runAt, see Enqueue.
+func (q *Queue) EnqueueAt(ctx context.Context, db wsqlx.Rdbms, payload []byte, runAt time.Time) (id int64, err error) {
+	ctx, span := q.startSpan(ctx, "queue enqueue", trace.SpanKindProducer)
+	defer func() {
+		span.SetAttributes(attribute.Int64("messaging.message.id", id))
+		endSpan(span, err)
+	}()
+
+	if db == nil {
+		db = q.db
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	query := squirrel.Insert(q.config.Table).
+		Columns("queue", "payload", "status", "attempts", "max_attempts", "run_at", "trace_parent", "created_at").
+		Values(q.config.Queue, payload, StatusPending, 0, q.config.MaxAttempts, runAt, carrier.Get("traceparent"), q.config.Now()).
+		Suffix("RETURNING id").
+		PlaceholderFormat(squirrel.Dollar)
+
+	err = db.QueryRowSq(ctx, query, wsqlx.QueryRowScanTypeDefault, &id)
+	return id, err
+}
+
+type jobRow struct {
+	ID          int64          `db:"id"`
+	Queue       string         `db:"queue"`
+	Payload     []byte         `db:"payload"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	RunAt       time.Time      `db:"run_at"`
+	LockedUntil time.Time      `db:"locked_until"`
+	CreatedAt   time.Time      `db:"created_at"`
+	TraceParent sql.NullString `db:"trace_parent"`
+}
+
+// Claim claims up to BatchSize jobs due to run, hiding them from the other
+// workers for VisibilityTimeout. Every job has to be completed, failed or
+// released. Jobs whose last attempt timed out are moved to StatusDead first.
+func (q *Queue) Claim(ctx context.Context) (jobs []Job, err error) {
+	ctx, span := q.startSpan(ctx, "queue claim", trace.SpanKindConsumer)
+	defer func() {
+		span.SetAttributes(attribute.Int("messaging.batch.message_count", len(jobs)))
+		endSpan(span, err)
+	}()
+
+	now := q.config.Now()
+	exhausted := squirrel.Update(q.config.Table).
+		Set("status", StatusDead).
+		Set("locked_until", nil).
+		Where(squirrel.Eq{"queue": q.config.Queue, "status": StatusPending}).
+		Where("attempts >= max_attempts").
+		Where(squirrel.LtOrEq{"locked_until": now}).
+		PlaceholderFormat(squirrel.Dollar)
+	if _, err = q.db.ExecSq(ctx, exhausted); err != nil {
+		return nil, err
+	}
+
+	due := squirrel.Select("id").
+		From(q.config.Table).
+		Where(squirrel.Eq{"queue": q.config.Queue, "status": StatusPending}).
+		Where("attempts < max_attempts").
+		Where(squirrel.LtOrEq{"run_at": now}).
+		Where(squirrel.Or{squirrel.Eq{"locked_until": nil}, squirrel.LtOrEq{"locked_until": now}}).
+		OrderBy("run_at", "id").
+		Limit(uint64(q.config.BatchSize)).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	query := squirrel.Update(q.config.Table).
+		Set("locked_until", now.Add(q.config.VisibilityTimeout)).
+		Set("attempts", squirrel.Expr("attempts + 1")).
+		Where(due.Prefix("id IN (").Suffix(")")).
+		Suffix("RETURNING id, queue, payload, attempts, max_attempts, run_at, locked_until, created_at, trace_parent").
+		PlaceholderFormat(squirrel.Dollar)
+
+	jobs = make([]Job, 0)
+	err = q.db.QuerySq(ctx, query, func(rows *sqlx.Rows) error {
+		for rows.Next() {
+			row := jobRow{}
+			if err := rows.StructScan(&row); err != nil {
+				return err
+			}
+			jobs = append(jobs, Job{
+				ID:          row.ID,
+				Queue:       row.Queue,
+				Payload:     row.Payload,
+				Attempts:    row.Attempts,
+				MaxAttempts: row.MaxAttempts,
+				RunAt:       row.RunAt,
+				LockedUntil: row.LockedUntil,
+				CreatedAt:   row.CreatedAt,
+				traceParent: row.TraceParent.String,
+			})
+		}
+		return rows.Err()
+	})
+	return jobs, err
+}
+
+// Complete removes a processed job.
+func (q *Queue) Complete(ctx context.Context, job Job) (err error) {
+	ctx, span := q.startSpan(ctx, "queue complete", trace.SpanKindConsumer, attribute.Int64("messaging.message.id", job.ID))
+	defer func() { endSpan(span, err) }()
+
+	query := squirrel.Delete(q.config.Table).
+		Where(squirrel.Eq{"id": job.ID, "attempts": job.Attempts}).
+		PlaceholderFormat(squirrel.Dollar)
+
+	return q.execOwned(ctx, query)
+}
+
+// Fail schedules the next attempt of job after Backoff, or moves it to
+// StatusDead once it reached its max attempts. jobErr is kept as last_error.
+func (q *Queue) Fail(ctx context.Context, job Job, jobErr error) (err error) {
+	ctx, span := q.startSpan(ctx, "queue fail", trace.SpanKindConsumer, attribute.Int64("messaging.message.id", job.ID))
+	defer func() { endSpan(span, err) }()
+
+	lastError := ""
+	if jobErr != nil {
+		lastError = jobErr.Error()
+	}
+
+	query := squirrel.Update(q.config.Table).
+		Set("locked_until", nil).
+		Set("last_error", lastError).
+		Where(squirrel.Eq{"id": job.ID, "attempts": job.Attempts}).
+		PlaceholderFormat(squirrel.Dollar)
+
+	if job.Attempts >= job.MaxAttempts {
+		span.SetAttributes(attribute.Bool("messaging.dead_letter", true))
+		query = query.Set("status", StatusDead)
+	} else {
+		query = query.Set("run_at", q.config.Now().Add(q.config.Backoff(job.Attempts)))
+	}
+
+	return q.execOwned(ctx, query)
+}
+
+// Release hands a claimed job back unprocessed, without counting the attempt,
+// so another worker can claim it right away.
+func (q *Queue) Release(ctx context.Context, job Job) (err error) {
+	ctx, span := q.startSpan(ctx, "queue release", trace.SpanKindConsumer, attribute.Int64("messaging.message.id", job.ID))
+	defer func() { endSpan(span, err) }()
+
+	query := squirrel.Update(q.config.Table).
+		Set("locked_until", nil).
+		Set("attempts", squirrel.Expr("attempts - 1")).
+		Where(squirrel.Eq{"id": job.ID, "attempts": job.Attempts}).
+		PlaceholderFormat(squirrel.Dollar)
+
+	return q.execOwned(ctx, query)
+}
+
+// execOwned runs a statement conditioned on the attempt of the job, which
+// matches no row once another worker claimed the job again.
+func (q *Queue) execOwned(ctx context.Context, query squirrel.Sqlizer) error {
+	res, err := q.db.ExecSq(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrJobLost
+	}
+	return nil
+}
+
+// Work claims and processes jobs with handler until ctx is done. A job is
+// completed when handler returns nil, and failed when it returns an error or
+// panics. The handler context ends when the visibility timeout of the job
+// does. A job whose visibility timeout ended before its turn in the batch is
+// released without counting the attempt, as are the claimed jobs not processed
+// yet once ctx is done.
+func (q *Queue) Work(ctx context.Context, handler func(ctx context.Context, job Job) error) error {
+	for {
+		jobs, err := q.Claim(ctx)
+		if err != nil && ctx.Err() == nil {
+			q.config.Logger.ErrorContext(ctx, "wsqlxqueue claim failed", slog.String("queue", q.config.Queue), slog.Any("error", err))
+		}
+
+		for i, job := range jobs {
+			if ctx.Err() != nil {
+				q.release(ctx, jobs[i:])
+				return nil
+			}
+			// The jobs of a batch share the lock taken at claim time, the handlers
+			// of the ones before may have used it up.
+			if !q.config.Now().Before(job.LockedUntil) {
+				q.release(ctx, jobs[i:i+1])
+				continue
+			}
+			q.process(ctx, job, handler)
+		}
+
+		if len(jobs) < q.config.BatchSize {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(q.config.PollInterval):
+			}
+		} else if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// release releases jobs the worker won't process. A job already claimed again
+// by another worker is left to it.
+func (q *Queue) release(ctx context.Context, jobs []Job) {
+	ctx = context.WithoutCancel(ctx)
+	for _, job := range jobs {
+		if err := q.Release(ctx, job); err != nil && !errors.Is(err, ErrJobLost) {
+			q.config.Logger.ErrorContext(ctx, "wsqlxqueue job release failed",
+				slog.String("queue", q.config.Queue), slog.Int64("job_id", job.ID), slog.Any("error", err))
+		}
+	}
+}
+
+func (q *Queue) process(ctx context.Context, job Job, handler func(ctx context.Context, job Job) error) {
+	carrier := propagation.MapCarrier{"traceparent": job.traceParent}
+	link := trace.LinkFromContext(propagation.TraceContext{}.Extract(ctx, carrier))
+
+	jobCtx, span := q.startSpan(ctx, "queue process", trace.SpanKindConsumer,
+		attribute.Int64("messaging.message.id", job.ID),
+		attribute.Int("messaging.message.delivery_count", job.Attempts),
+	)
+	if link.SpanContext.IsValid() {
+		span.AddLink(link)
+	}
+	defer span.End()
+
+	jobCtx, cancel := context.WithDeadline(jobCtx, job.LockedUntil)
+	defer cancel()
+
+	err := q.handle(jobCtx, job, handler)
+
+	// The outcome is recorded even when the worker is shutting down.
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		err = q.Fail(ctx, job, err)
+	} else {
+		err = q.Complete(ctx, job)
+	}
+	if err != nil {
+		q.config.Logger.ErrorContext(ctx, "wsqlxqueue job update failed",
+			slog.String("queue", q.config.Queue), slog.Int64("job_id", job.ID), slog.Any("error", err))
+	}
+}
+
+func (q *Queue) handle(ctx context.Context, job Job, handler func(ctx context.Context, job Job) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("wsqlxqueue: job panicked: %v", p)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+func (q *Queue) startSpan(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs,
+		attribute.String("messaging.system", "wsqlx"),
+		attribute.String("messaging.destination.name", q.config.Queue),
+	)
+	return q.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,255 @@
+package wsqlxqueue_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxqueue"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	exhaustedSQL = `UPDATE jobs SET status = $1, locked_until = $2 WHERE queue = $3 AND status = $4 AND attempts >= max_attempts AND locked_until <= $5`
+	claimSQL     = `UPDATE jobs SET locked_until = $1, attempts = attempts + 1 WHERE id IN ( SELECT id FROM jobs WHERE queue = $2 AND status = $3 AND attempts < max_attempts AND run_at <= $4 AND (locked_until IS NULL OR locked_until <= $5) ORDER BY run_at, id LIMIT 10 FOR UPDATE SKIP LOCKED ) RETURNING id, queue, payload, attempts, max_attempts, run_at, locked_until, created_at, trace_parent`
+)
+
+var jobColumns = []string{"id", "queue", "payload", "attempts", "max_attempts", "run_at", "locked_until", "created_at", "trace_parent"}
+
+func newQueue(t *testing.T) (*wsqlxqueue.Queue, wsqlx.RdbmsTx, sqlmock.Sqlmock, time.Time) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { dbMock.Close() })
+
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	sqlxx := wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"))
+	q := wsqlxqueue.New(sqlxx, wsqlxqueue.Config{
+		Table:        "jobs",
+		MaxAttempts:  3,
+		PollInterval: time.Millisecond,
+		Now:          func() time.Time { return now },
+	})
+	return q, sqlxx, mock, now
+}
+
+func Test_Queue(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("should enqueue within the transaction of the caller", func(t *testing.T) {
+		q, sqlxx, mock, now := newQueue(t)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO jobs (queue,payload,status,attempts,max_attempts,run_at,trace_parent,created_at) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id`)).
+			WithArgs("default", []byte(`{"user":1}`), wsqlxqueue.StatusPending, 0, 3, now, "", now).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+		mock.ExpectCommit()
+
+		var id int64
+		err := sqlxx.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) (err error) {
+			id, err = q.Enqueue(ctx, tx, []byte(`{"user":1}`))
+			return err
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(7), id)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should claim due jobs", func(t *testing.T) {
+		q, _, mock, now := newQueue(t)
+
+		lockedUntil := now.Add(5 * time.Minute)
+		mock.ExpectExec(regexp.QuoteMeta(exhaustedSQL)).
+			WithArgs(wsqlxqueue.StatusDead, nil, "default", wsqlxqueue.StatusPending, now).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(claimSQL)).
+			WithArgs(lockedUntil, "default", wsqlxqueue.StatusPending, now, now).
+			WillReturnRows(sqlmock.NewRows(jobColumns).
+				AddRow(1, "default", []byte("a"), 1, 3, now, lockedUntil, now, nil).
+				AddRow(2, "default", []byte("b"), 2, 3, now, lockedUntil, now, ""))
+
+		jobs, err := q.Claim(ctx)
+		require.NoError(t, err)
+		require.Len(t, jobs, 2)
+		require.Equal(t, int64(1), jobs[0].ID)
+		require.Equal(t, []byte("a"), jobs[0].Payload)
+		require.Equal(t, lockedUntil, jobs[0].LockedUntil)
+		require.Equal(t, 2, jobs[1].Attempts)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not claim when moving timed out jobs to dead fails", func(t *testing.T) {
+		q, _, mock, _ := newQueue(t)
+
+		mock.ExpectExec(regexp.QuoteMeta(exhaustedSQL)).
+			WillReturnError(errors.New("conn closed"))
+
+		jobs, err := q.Claim(ctx)
+		require.Error(t, err)
+		require.Nil(t, jobs)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should release a job without counting the attempt", func(t *testing.T) {
+		q, _, mock, _ := newQueue(t)
+
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET locked_until = $1, attempts = attempts - 1 WHERE attempts = $2 AND id = $3`)).
+			WithArgs(nil, 2, int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, q.Release(ctx, wsqlxqueue.Job{ID: 5, Attempts: 2, MaxAttempts: 3}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should complete a job", func(t *testing.T) {
+		q, _, mock, _ := newQueue(t)
+
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM jobs WHERE attempts = $1 AND id = $2`)).
+			WithArgs(1, int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		require.NoError(t, q.Complete(ctx, wsqlxqueue.Job{ID: 5, Attempts: 1, MaxAttempts: 3}))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return ErrJobLost when the job was claimed again", func(t *testing.T) {
+		q, _, mock, _ := newQueue(t)
+
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM jobs WHERE attempts = $1 AND id = $2`)).
+			WithArgs(1, int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err := q.Complete(ctx, wsqlxqueue.Job{ID: 5, Attempts: 1, MaxAttempts: 3})
+		require.ErrorIs(t, err, wsqlxqueue.ErrJobLost)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should retry a failed job after the backoff", func(t *testing.T) {
+		q, _, mock, now := newQueue(t)
+
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET locked_until = $1, last_error = $2, run_at = $3 WHERE attempts = $4 AND id = $5`)).
+			WithArgs(nil, "boom", now.Add(2*time.Second), 2, int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := q.Fail(ctx, wsqlxqueue.Job{ID: 5, Attempts: 2, MaxAttempts: 3}, errors.New("boom"))
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should move a job to dead after its max attempts", func(t *testing.T) {
+		q, _, mock, _ := newQueue(t)
+
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET locked_until = $1, last_error = $2, status = $3 WHERE attempts = $4 AND id = $5`)).
+			WithArgs(nil, "boom", wsqlxqueue.StatusDead, 3, int64(5)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := q.Fail(ctx, wsqlxqueue.Job{ID: 5, Attempts: 3, MaxAttempts: 3}, errors.New("boom"))
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should fail a panicking job and stop when ctx is done", func(t *testing.T) {
+		q, _, mock, now := newQueue(t)
+		workCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		mock.ExpectExec(regexp.QuoteMeta(exhaustedSQL)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(claimSQL)).
+			WillReturnRows(sqlmock.NewRows(jobColumns).AddRow(1, "default", []byte("a"), 1, 3, now, time.Now().Add(time.Minute), now, nil))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET locked_until = $1, last_error = $2, run_at = $3 WHERE attempts = $4 AND id = $5`)).
+			WithArgs(nil, "wsqlxqueue: job panicked: boom", now.Add(time.Second), 1, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err := q.Work(workCtx, func(ctx context.Context, job wsqlxqueue.Job) error {
+			cancel()
+			panic("boom")
+		})
+		require.NoError(t, err)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should release the claimed jobs left when ctx is done", func(t *testing.T) {
+		q, _, mock, now := newQueue(t)
+		workCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		lockedUntil := time.Now().Add(time.Minute)
+		mock.ExpectExec(regexp.QuoteMeta(exhaustedSQL)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(claimSQL)).
+			WillReturnRows(sqlmock.NewRows(jobColumns).
+				AddRow(1, "default", []byte("a"), 1, 3, now, lockedUntil, now, nil).
+				AddRow(2, "default", []byte("b"), 1, 3, now, lockedUntil, now, nil))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM jobs WHERE attempts = $1 AND id = $2`)).
+			WithArgs(1, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET locked_until = $1, attempts = attempts - 1 WHERE attempts = $2 AND id = $3`)).
+			WithArgs(nil, 1, int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var handled []int64
+		err := q.Work(workCtx, func(ctx context.Context, job wsqlxqueue.Job) error {
+			handled = append(handled, job.ID)
+			cancel()
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []int64{1}, handled)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should release the jobs of a batch whose lock expired before their turn", func(t *testing.T) {
+		dbMock, mock, err := sqlmock.New()
+		require.NoError(t, err)
+		defer dbMock.Close()
+
+		q := wsqlxqueue.New(wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock")), wsqlxqueue.Config{
+			Table:             "jobs",
+			BatchSize:         2,
+			VisibilityTimeout: 50 * time.Millisecond,
+			PollInterval:      time.Millisecond,
+			Logger:            slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+		workCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		now := time.Now()
+		lockedUntil := now.Add(50 * time.Millisecond)
+		mock.ExpectExec(regexp.QuoteMeta(exhaustedSQL)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(regexp.QuoteMeta(strings.Replace(claimSQL, "LIMIT 10", "LIMIT 2", 1))).
+			WillReturnRows(sqlmock.NewRows(jobColumns).
+				AddRow(1, "default", []byte("a"), 1, 5, now, lockedUntil, now, nil).
+				AddRow(2, "default", []byte("b"), 1, 5, now, lockedUntil, now, nil))
+		mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM jobs WHERE attempts = $1 AND id = $2`)).
+			WithArgs(1, int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(`UPDATE jobs SET locked_until = $1, attempts = attempts - 1 WHERE attempts = $2 AND id = $3`)).
+			WithArgs(nil, 1, int64(2)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var handled []int64
+		done := make(chan error, 1)
+		go func() {
+			done <- q.Work(workCtx, func(ctx context.Context, job wsqlxqueue.Job) error {
+				handled = append(handled, job.ID)
+				time.Sleep(80 * time.Millisecond)
+				return nil
+			})
+		}()
+
+		require.Eventually(t, func() bool { return mock.ExpectationsWereMet() == nil }, time.Second, 5*time.Millisecond)
+		cancel()
+		require.NoError(t, <-done)
+		require.Equal(t, []int64{1}, handled)
+	})
+}
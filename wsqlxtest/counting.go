@@ -0,0 +1,157 @@
+package wsqlxtest
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+)
+
+// CountingDB is a DB counting the statements the wsqlx rdbms beneath it
+// executes for its calls, including the ones run inside DoTx, grouped by
+// wsqlx.SQLFingerprint. It relies on wsqlx.ContextWithQueryCounterOf, so
+// statements answered from the cache and DBs not backed by an rdbms, such as a
+// replaying DB, count nothing.
+type CountingDB struct {
+	*wsqlx.QueryCounter
+	db DB
+}
+
+var _ DB = (*CountingDB)(nil)
+
+func NewCountingDB(db DB) *CountingDB {
+	return &CountingDB{QueryCounter: wsqlx.NewQueryCounter(), db: db}
+}
+
+// AssertQueryCount fails the test unless fn runs exactly n statements through
+// db. The failure lists the statements fn ran by fingerprint.
+func AssertQueryCount(t testing.TB, db *CountingDB, n int, fn func()) {
+	t.Helper()
+
+	before := db.Counts()
+	fn()
+
+	got := 0
+	statements := strings.Builder{}
+	for fingerprint, count := range db.Counts() {
+		if count -= before[fingerprint]; count > 0 {
+			got += count
+			fmt.Fprintf(&statements, "\t%dx %s\n", count, fingerprint)
+		}
+	}
+
+	if got != n {
+		t.Errorf("wsqlxtest: expected %d queries, got %d:\n%s", n, got, statements.String())
+	}
+}
+
+// context returns ctx making the rdbms count its statements into c.
+func (c *CountingDB) context(ctx context.Context) context.Context {
+	return wsqlx.ContextWithQueryCounterOf(ctx, c.QueryCounter)
+}
+
+func (c *CountingDB) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	return (&countingRdbms{counter: c, rdbms: c.db}).QuerySq(ctx, query, callback)
+}
+
+func (c *CountingDB) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return (&countingRdbms{counter: c, rdbms: c.db}).QuerySqPagination(ctx, countQuery, query, pagination, callback)
+}
+
+func (c *CountingDB) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return (&countingRdbms{counter: c, rdbms: c.db}).QuerySqPaginationAuto(ctx, query, pagination, strategy, callback)
+}
+
+func (c *CountingDB) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationNoCountOutput, error) {
+	return (&countingRdbms{counter: c, rdbms: c.db}).QuerySqPaginationNoCount(ctx, query, pagination, callback)
+}
+
+func (c *CountingDB) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+	return (&countingRdbms{counter: c, rdbms: c.db}).QueryRowSq(ctx, query, scanType, dest)
+}
+
+func (c *CountingDB) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error) {
+	return (&countingRdbms{counter: c, rdbms: c.db}).ExecSq(ctx, query)
+}
+
+// Unwrap returns the wrapped DB, for wsqlx.LockTx.
+func (c *CountingDB) Unwrap() wsqlx.Rdbms {
+	return c.db
+}
+
+func (c *CountingDB) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx wsqlx.Rdbms) error) error {
+	return c.db.DoTx(ctx, opt, func(tx wsqlx.Rdbms) error {
+		return fn(c.wrapTx(tx))
+	})
+}
+
+func (c *CountingDB) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) error {
+	return c.db.DoTxContext(ctx, opt, func(ctx context.Context, tx wsqlx.Rdbms) error {
+		return fn(ctx, c.wrapTx(tx))
+	})
+}
+
+// wrapTx returns the counting Rdbms passed to DoTx callbacks.
+func (c *CountingDB) wrapTx(tx wsqlx.Rdbms) *countingRdbms {
+	nested, _ := tx.(wsqlx.Tx)
+	return &countingRdbms{counter: c, rdbms: tx, tx: nested}
+}
+
+type countingRdbms struct {
+	counter *CountingDB
+	rdbms   wsqlx.Rdbms
+	tx      wsqlx.Tx
+}
+
+var _ wsqlx.Tx = (*countingRdbms)(nil)
+
+// Unwrap returns the transaction, for wsqlx.LockTx.
+func (c *countingRdbms) Unwrap() wsqlx.Rdbms {
+	return c.rdbms
+}
+
+// DoTx runs fn in a savepoint of the transaction, counting its statements.
+func (c *countingRdbms) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx wsqlx.Rdbms) error) error {
+	return c.DoTxContext(ctx, opt, func(_ context.Context, tx wsqlx.Rdbms) error {
+		return fn(tx)
+	})
+}
+
+func (c *countingRdbms) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) error {
+	if c.tx == nil {
+		return errors.New("wsqlxtest: the transaction does not support nested transactions")
+	}
+	return c.tx.DoTxContext(ctx, opt, func(ctx context.Context, tx wsqlx.Rdbms) error {
+		return fn(ctx, c.counter.wrapTx(tx))
+	})
+}
+
+func (c *countingRdbms) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	return c.rdbms.QuerySq(c.counter.context(ctx), query, callback)
+}
+
+func (c *countingRdbms) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return c.rdbms.QuerySqPagination(c.counter.context(ctx), countQuery, query, pagination, callback)
+}
+
+func (c *countingRdbms) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	return c.rdbms.QuerySqPaginationAuto(c.counter.context(ctx), query, pagination, strategy, callback)
+}
+
+func (c *countingRdbms) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationNoCountOutput, error) {
+	return c.rdbms.QuerySqPaginationNoCount(c.counter.context(ctx), query, pagination, callback)
+}
+
+func (c *countingRdbms) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+	return c.rdbms.QueryRowSq(c.counter.context(ctx), query, scanType, dest)
+}
+
+func (c *countingRdbms) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error) {
+	return c.rdbms.ExecSq(c.counter.context(ctx), query)
+}
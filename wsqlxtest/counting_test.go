@@ -0,0 +1,142 @@
+package wsqlxtest_test
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest/wsqlxsqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_AssertQueryCount(t *testing.T) {
+	ctx := context.TODO()
+	db := wsqlxtest.NewCountingDB(wsqlxsqlite.New(t, []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		`INSERT INTO users (name) VALUES ('iban'), ('rama')`,
+	}))
+
+	loadNames := func(ids ...int64) {
+		for _, id := range ids {
+			var name string
+			err := db.QueryRowSq(ctx, squirrel.Select("name").From("users").Where(squirrel.Eq{"id": id}),
+				wsqlx.QueryRowScanTypeDefault, &name)
+			require.NoError(t, err)
+		}
+	}
+
+	wsqlxtest.AssertQueryCount(t, db, 2, func() {
+		loadNames(1, 2)
+	})
+
+	wsqlxtest.AssertQueryCount(t, db, 1, func() {
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			_, err := tx.ExecSq(ctx, squirrel.Update("users").Set("name", "syaiban").Where(squirrel.Eq{"id": 1}))
+			return err
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("should report the statements on mismatch", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+		wsqlxtest.AssertQueryCount(rt, db, 1, func() {
+			loadNames(1, 2)
+		})
+		require.Len(t, rt.errors, 1)
+		require.Contains(t, rt.errors[0], "2x SELECT name FROM users WHERE id = ?")
+	})
+
+	require.Equal(t, 5, db.Total())
+}
+
+func Test_CountingDB_QuerySqPaginationAuto(t *testing.T) {
+	ctx := context.TODO()
+	db := wsqlxtest.NewCountingDB(wsqlxsqlite.New(t, []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		`INSERT INTO users (name) VALUES ('iban'), ('rama')`,
+	}))
+	query := squirrel.Select("id", "name").From("users").OrderBy("id")
+	skip := func(rows *sqlx.Rows) error { return nil }
+
+	t.Run("should count the derived count query", func(t *testing.T) {
+		wsqlxtest.AssertQueryCount(t, db, 2, func() {
+			_, err := db.QuerySqPaginationAuto(ctx, query, wsqlx.PaginationInput{Page: 1, PageSize: 10}, wsqlx.CountStrategySubquery, skip)
+			require.NoError(t, err)
+		})
+	})
+
+	t.Run("should count the window count fallback only past the last page", func(t *testing.T) {
+		wsqlxtest.AssertQueryCount(t, db, 1, func() {
+			_, err := db.QuerySqPaginationAuto(ctx, query, wsqlx.PaginationInput{Page: 1, PageSize: 10}, wsqlx.CountStrategyWindow, skip)
+			require.NoError(t, err)
+		})
+		wsqlxtest.AssertQueryCount(t, db, 2, func() {
+			_, err := db.QuerySqPaginationAuto(ctx, query, wsqlx.PaginationInput{Page: 3, PageSize: 10}, wsqlx.CountStrategyWindow, skip)
+			require.NoError(t, err)
+		})
+	})
+
+	t.Run("should not count a count query for count-less pagination", func(t *testing.T) {
+		wsqlxtest.AssertQueryCount(t, db, 1, func() {
+			_, err := db.QuerySqPaginationNoCount(ctx, query, wsqlx.PaginationInput{Page: 1, PageSize: 10}, skip)
+			require.NoError(t, err)
+		})
+	})
+}
+
+func Test_CountingDB_EstimatedCount(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := wsqlx.ContextWithQueryCounter(context.TODO())
+	db := wsqlxtest.NewCountingDB(wsqlx.NewRdbms(sqlx.NewDb(dbMock, "sqlmock"),
+		wsqlx.WithDialect(wsqlx.DialectPostgres), wsqlx.WithEstimatedCount(1000)))
+
+	mock.ExpectQuery(regexp.QuoteMeta(`EXPLAIN (FORMAT JSON) SELECT id FROM events`)).
+		WillReturnRows(sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[{"Plan": {"Plan Rows": 500000000}}]`))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT id FROM events LIMIT 10 OFFSET 0`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+	wsqlxtest.AssertQueryCount(t, db, 2, func() {
+		_, err := db.QuerySqPagination(ctx, squirrel.Select("COUNT(*)").From("events"), squirrel.Select("id").From("events"),
+			wsqlx.PaginationInput{Page: 1, PageSize: 10}, func(rows *sqlx.Rows) error { return nil })
+		require.NoError(t, err)
+	})
+	require.NoError(t, mock.ExpectationsWereMet())
+
+	require.Equal(t, map[string]int{
+		"EXPLAIN (FORMAT JSON) SELECT id FROM events": 1,
+		"SELECT id FROM events LIMIT ? OFFSET ?":      1,
+	}, db.Counts())
+
+	requestCounter, ok := wsqlx.QueryCounterFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, 2, requestCounter.Total())
+}
+
+func Test_CountingDB_NestedDoTx(t *testing.T) {
+	ctx := context.TODO()
+	db := wsqlxtest.NewCountingDB(wsqlxsqlite.New(t, []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+	}))
+
+	wsqlxtest.AssertQueryCount(t, db, 2, func() {
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			if _, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban")); err != nil {
+				return err
+			}
+			return tx.(wsqlx.Tx).DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+				_, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("rama"))
+				return err
+			})
+		})
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,600 @@
+package wsqlxtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/internal/sqltext"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/internal/staticrows"
+	"github.com/jmoiron/sqlx"
+)
+
+// UpdateGoldenEnv is the environment variable making Golden record against the
+// database instead of replaying the golden file.
+const UpdateGoldenEnv = "WSQLX_UPDATE_GOLDEN"
+
+// ErrReplayMismatch is returned by a replaying DB when the code under test
+// issues a call that differs from the recording.
+var ErrReplayMismatch = errors.New("wsqlxtest: call does not match the recording")
+
+const (
+	callBeginTx  = "BeginTx"
+	callCommit   = "Commit"
+	callRollback = "Rollback"
+)
+
+// RecordedCall is one entry of a golden file.
+type RecordedCall struct {
+	Method    string          `json:"method"`
+	SQL       string          `json:"sql,omitempty"`
+	CountSQL  string          `json:"count_sql,omitempty"`
+	CountArgs []recordedValue `json:"count_args,omitempty"`
+	Args      []recordedValue `json:"args,omitempty"`
+	// Pagination and CountStrategy are the arguments of the pagination calls
+	// deciding the LIMIT, OFFSET and count query they run.
+	Pagination    *wsqlx.PaginationInput `json:"pagination,omitempty"`
+	CountStrategy wsqlx.CountStrategy    `json:"count_strategy,omitempty"`
+	Columns       []string               `json:"columns,omitempty"`
+	Rows          [][]recordedValue      `json:"rows,omitempty"`
+	RowsAffected  int64                  `json:"rows_affected,omitempty"`
+	LastInsertID  int64                  `json:"last_insert_id,omitempty"`
+	Output        json.RawMessage        `json:"output,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+}
+
+// Golden records the calls of the DB returned by connect into the golden file
+// at path when UpdateGoldenEnv is set, and replays the golden file without a
+// database otherwise.
+func Golden(t testing.TB, path string, connect func() DB) DB {
+	t.Helper()
+
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		return Record(t, path, connect())
+	}
+	return Replay(t, path)
+}
+
+// Record returns a DB passing every call to db and writing the SQL, arguments,
+// results, errors and transaction boundaries to the golden file at path at
+// t.Cleanup.
+func Record(t testing.TB, path string, db DB) DB {
+	t.Helper()
+
+	rec := &recording{}
+	t.Cleanup(func() {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		data, err := json.MarshalIndent(rec.calls, "", "  ")
+		if err == nil {
+			err = os.MkdirAll(filepath.Dir(path), 0o755)
+		}
+		if err == nil {
+			err = os.WriteFile(path, append(data, '\n'), 0o644)
+		}
+		if err != nil {
+			t.Errorf("wsqlxtest: write golden file %s: %v", path, err)
+		}
+	})
+
+	return &recorder{rdbms: db, tx: db, rec: rec}
+}
+
+// Replay returns a DB serving the results recorded in the golden file at path.
+// Every call is compared with the recording and fails the test when the
+// method, SQL or arguments differ. Unconsumed recorded calls fail the test at
+// t.Cleanup.
+func Replay(t testing.TB, path string) DB {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("wsqlxtest: read golden file %s: %v", path, err)
+	}
+
+	r := &replayer{t: t}
+	if err = json.Unmarshal(data, &r.calls); err != nil {
+		t.Fatalf("wsqlxtest: parse golden file %s: %v", path, err)
+	}
+	t.Cleanup(func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.pos < len(r.calls) {
+			t.Errorf("wsqlxtest: %d recorded calls were not issued, next is %s %s",
+				len(r.calls)-r.pos, r.calls[r.pos].Method, r.calls[r.pos].SQL)
+		}
+	})
+
+	return r
+}
+
+type recording struct {
+	mu    sync.Mutex
+	calls []RecordedCall
+}
+
+func (r *recording) add(call RecordedCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+var (
+	_ DB = (*recorder)(nil)
+	_ DB = (*replayer)(nil)
+)
+
+type recorder struct {
+	rdbms wsqlx.Rdbms
+	// tx is nil inside a transaction callback, unless the Rdbms passed to the
+	// callback also implements wsqlx.Tx.
+	tx  wsqlx.Tx
+	rec *recording
+}
+
+func (r *recorder) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	call := newRecordedCall("QuerySq", query)
+
+	var captured *staticrows.Rows
+	err := r.rdbms.QuerySq(ctx, query, func(rows *sqlx.Rows) (err error) {
+		if captured, err = staticrows.Read(rows.Rows); err != nil {
+			return err
+		}
+		return replayRows(ctx, captured, callback)
+	})
+
+	call.setRows(captured)
+	call.setError(err)
+	r.rec.add(call)
+	return err
+}
+
+func (r *recorder) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error) {
+	call := newRecordedCall("ExecSq", query)
+
+	res, err := r.rdbms.ExecSq(ctx, query)
+	if res != nil {
+		call.RowsAffected, _ = res.RowsAffected()
+		call.LastInsertID, _ = res.LastInsertId()
+	}
+
+	call.setError(err)
+	r.rec.add(call)
+	return res, err
+}
+
+// QueryRowSq is recorded as dest encoded as JSON, so dest has to survive a JSON
+// round trip for the replay to fill it.
+func (r *recorder) QueryRowSq(ctx context.Context, query squirrel.Sqlizer, scanType wsqlx.QueryRowScanType, dest interface{}) error {
+	call := newRecordedCall("QueryRowSq", query)
+
+	err := r.rdbms.QueryRowSq(ctx, query, scanType, dest)
+	if err == nil {
+		call.setOutput(dest)
+	}
+
+	call.setError(err)
+	r.rec.add(call)
+	return err
+}
+
+func (r *recorder) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	call := newRecordedCall("QuerySqPagination", query)
+	count := newRecordedCall("", countQuery)
+	call.CountSQL, call.CountArgs = count.SQL, count.Args
+	call.Pagination = &pagination
+
+	var captured *staticrows.Rows
+	output, err := r.rdbms.QuerySqPagination(ctx, countQuery, query, pagination, func(rows *sqlx.Rows) (err error) {
+		if captured, err = staticrows.Read(rows.Rows); err != nil {
+			return err
+		}
+		return replayRows(ctx, captured, callback)
+	})
+
+	call.setRows(captured)
+	call.setOutput(output)
+	call.setError(err)
+	r.rec.add(call)
+	return output, err
+}
+
+func (r *recorder) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	call := newRecordedCall("QuerySqPaginationAuto", query)
+	call.Pagination, call.CountStrategy = &pagination, strategy
+
+	var captured *staticrows.Rows
+	output, err := r.rdbms.QuerySqPaginationAuto(ctx, query, pagination, strategy, func(rows *sqlx.Rows) (err error) {
+		if captured, err = staticrows.Read(rows.Rows); err != nil {
+			return err
+		}
+		return replayRows(ctx, captured, callback)
+	})
+
+	call.setRows(captured)
+	call.setOutput(output)
+	call.setError(err)
+	r.rec.add(call)
+	return output, err
+}
+
+func (r *recorder) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationNoCountOutput, error) {
+	call := newRecordedCall("QuerySqPaginationNoCount", query)
+	call.Pagination = &pagination
+
+	var captured *staticrows.Rows
+	output, err := r.rdbms.QuerySqPaginationNoCount(ctx, query, pagination, func(rows *sqlx.Rows) (err error) {
+		if captured, err = staticrows.Read(rows.Rows); err != nil {
+			return err
+		}
+		return replayRows(ctx, captured, callback)
+	})
+
+	call.setRows(captured)
+	call.setOutput(output)
+	call.setError(err)
+	r.rec.add(call)
+	return output, err
+}
+
+// Unwrap returns the recorded Rdbms, for wsqlx.LockTx. The lock statements are
+// not recorded.
+func (r *recorder) Unwrap() wsqlx.Rdbms {
+	return r.rdbms
+}
+
+func (r *recorder) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx wsqlx.Rdbms) error) error {
+	return r.DoTxContext(ctx, opt, func(_ context.Context, tx wsqlx.Rdbms) error {
+		return fn(tx)
+	})
+}
+
+func (r *recorder) DoTxContext(ctx context.Context, opt *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) error {
+	if r.tx == nil {
+		return errors.New("wsqlxtest: the recorded Rdbms does not support transactions")
+	}
+
+	var began bool
+	var fnErr error
+	err := r.tx.DoTxContext(ctx, opt, func(ctx context.Context, tx wsqlx.Rdbms) error {
+		began = true
+		r.rec.add(RecordedCall{Method: callBeginTx})
+		nested, _ := tx.(wsqlx.Tx)
+		fnErr = fn(ctx, &recorder{rdbms: tx, tx: nested, rec: r.rec})
+		return fnErr
+	})
+
+	// A failed begin is recorded on BeginTx, a failed commit on Commit.
+	call := RecordedCall{Method: callCommit}
+	if !began {
+		call.Method = callBeginTx
+	} else if fnErr != nil {
+		call.Method = callRollback
+	}
+	call.setError(err)
+	r.rec.add(call)
+	return err
+}
+
+type replayer struct {
+	t testing.TB
+
+	mu    sync.Mutex
+	calls []RecordedCall
+	pos   int
+}
+
+// next returns the recorded call matching the issued one, failing the test
+// when it diverges.
+func (r *replayer) next(method string, query squirrel.Sqlizer) (RecordedCall, error) {
+	r.t.Helper()
+
+	issued := RecordedCall{Method: method}
+	if query != nil {
+		issued = newRecordedCall(method, query)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pos >= len(r.calls) {
+		r.t.Errorf("wsqlxtest: unexpected %s %s %s, the recording has no more calls", method, issued.SQL, argsJSON(issued.Args))
+		return RecordedCall{}, ErrReplayMismatch
+	}
+
+	recorded := r.calls[r.pos]
+	r.pos++
+	if recorded.Method != issued.Method || recorded.SQL != issued.SQL || argsJSON(recorded.Args) != argsJSON(issued.Args) {
+		r.t.Errorf("wsqlxtest: call %d diverges from the recording\n\tgot:  %s %s %s\n\twant: %s %s %s", r.pos,
+			issued.Method, issued.SQL, argsJSON(issued.Args), recorded.Method, recorded.SQL, argsJSON(recorded.Args))
+		return RecordedCall{}, ErrReplayMismatch
+	}
+
+	return recorded, nil
+}
+
+func (r *replayer) QuerySq(ctx context.Context, query squirrel.Sqlizer, callback func(rows *sqlx.Rows) error) error {
+	call, err := r.next("QuerySq", query)
+	if err != nil {
+		return err
+	}
+	if len(call.Columns) > 0 {
+		if err = replayRows(ctx, call.rows(), callback); err != nil {
+			return err
+		}
+	}
+	return call.err()
+}
+
+func (r *replayer) ExecSq(ctx context.Context, query squirrel.Sqlizer) (sql.Result, error) {
+	call, err := r.next("ExecSq", query)
+	if err != nil {
+		return nil, err
+	}
+	if err = call.err(); err != nil {
+		return nil, err
+	}
+	return replayResult{call: call}, nil
+}
+
+func (r *replayer) QueryRowSq(_ context.Context, query squirrel.Sqlizer, _ wsqlx.QueryRowScanType, dest interface{}) error {
+	call, err := r.next("QueryRowSq", query)
+	if err != nil {
+		return err
+	}
+	if err = call.err(); err != nil {
+		return err
+	}
+	return json.Unmarshal(call.Output, dest)
+}
+
+func (r *replayer) QuerySqPagination(ctx context.Context, countQuery, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	output := wsqlx.PaginationOutput{}
+	err := r.replayPagination(ctx, "QuerySqPagination", query, pagination, 0, callback, &output, func(call RecordedCall) error {
+		count := newRecordedCall("", countQuery)
+		if count.SQL != call.CountSQL || argsJSON(count.Args) != argsJSON(call.CountArgs) {
+			r.t.Errorf("wsqlxtest: count query diverges from the recording\n\tgot:  %s %s\n\twant: %s %s",
+				count.SQL, argsJSON(count.Args), call.CountSQL, argsJSON(call.CountArgs))
+			return ErrReplayMismatch
+		}
+		return nil
+	})
+	return output, err
+}
+
+func (r *replayer) QuerySqPaginationAuto(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationOutput, error) {
+	output := wsqlx.PaginationOutput{}
+	err := r.replayPagination(ctx, "QuerySqPaginationAuto", query, pagination, strategy, callback, &output, nil)
+	return output, err
+}
+
+func (r *replayer) QuerySqPaginationNoCount(ctx context.Context, query squirrel.SelectBuilder, pagination wsqlx.PaginationInput, callback func(rows *sqlx.Rows) error) (wsqlx.PaginationNoCountOutput, error) {
+	output := wsqlx.PaginationNoCountOutput{}
+	err := r.replayPagination(ctx, "QuerySqPaginationNoCount", query, pagination, 0, callback, &output, nil)
+	return output, err
+}
+
+func (r *replayer) replayPagination(ctx context.Context, method string, query squirrel.Sqlizer, pagination wsqlx.PaginationInput,
+	strategy wsqlx.CountStrategy, callback func(rows *sqlx.Rows) error, output any, check func(call RecordedCall) error) error {
+	call, err := r.next(method, query)
+	if err != nil {
+		return err
+	}
+	if call.Pagination == nil || *call.Pagination != pagination || call.CountStrategy != strategy {
+		r.t.Errorf("wsqlxtest: pagination diverges from the recording\n\tgot:  %+v strategy %d\n\twant: %+v strategy %d",
+			pagination, strategy, call.Pagination, call.CountStrategy)
+		return ErrReplayMismatch
+	}
+	if check != nil {
+		if err = check(call); err != nil {
+			return err
+		}
+	}
+	if len(call.Output) > 0 {
+		if err = json.Unmarshal(call.Output, output); err != nil {
+			return err
+		}
+	}
+	if len(call.Columns) > 0 {
+		if err = replayRows(ctx, call.rows(), callback); err != nil {
+			return err
+		}
+	}
+	return call.err()
+}
+
+func (r *replayer) DoTx(ctx context.Context, opt *sql.TxOptions, fn func(tx wsqlx.Rdbms) error) error {
+	return r.DoTxContext(ctx, opt, func(_ context.Context, tx wsqlx.Rdbms) error {
+		return fn(tx)
+	})
+}
+
+func (r *replayer) DoTxContext(ctx context.Context, _ *sql.TxOptions, fn func(ctx context.Context, tx wsqlx.Rdbms) error) error {
+	begin, err := r.next(callBeginTx, nil)
+	if err != nil {
+		return err
+	}
+	if err = begin.err(); err != nil {
+		return err
+	}
+
+	fnErr := fn(ctx, r)
+
+	method := callCommit
+	if fnErr != nil {
+		method = callRollback
+	}
+	call, err := r.next(method, nil)
+	if err != nil {
+		return errors.Join(fnErr, err)
+	}
+	if fnErr != nil {
+		return fnErr
+	}
+	return call.err()
+}
+
+type replayResult struct {
+	call RecordedCall
+}
+
+func (r replayResult) LastInsertId() (int64, error) {
+	return r.call.LastInsertID, nil
+}
+
+func (r replayResult) RowsAffected() (int64, error) {
+	return r.call.RowsAffected, nil
+}
+
+var recordedNoRows = sql.ErrNoRows.Error()
+
+func newRecordedCall(method string, query squirrel.Sqlizer) RecordedCall {
+	call := RecordedCall{Method: method}
+
+	stmt, args, err := query.ToSql()
+	if err != nil {
+		call.Error = err.Error()
+		return call
+	}
+
+	call.SQL = sqltext.Normalize(stmt)
+	for _, arg := range args {
+		call.Args = append(call.Args, newRecordedValue(arg))
+	}
+	return call
+}
+
+func (c *RecordedCall) setRows(rows *staticrows.Rows) {
+	if rows == nil {
+		return
+	}
+	c.Columns = rows.Columns
+	for _, row := range rows.Values {
+		recordedRow := make([]recordedValue, len(row))
+		for i, v := range row {
+			recordedRow[i] = newRecordedValue(v)
+		}
+		c.Rows = append(c.Rows, recordedRow)
+	}
+}
+
+func (c *RecordedCall) setOutput(output any) {
+	c.Output, _ = json.Marshal(output)
+}
+
+func (c *RecordedCall) setError(err error) {
+	if err != nil {
+		c.Error = err.Error()
+	}
+}
+
+// err rebuilds the recorded error. Only sql.ErrNoRows keeps its identity.
+func (c RecordedCall) err() error {
+	switch {
+	case c.Error == "":
+		return nil
+	case strings.HasSuffix(c.Error, recordedNoRows):
+		return fmt.Errorf("%s: %w", strings.TrimSuffix(strings.TrimSuffix(c.Error, recordedNoRows), ": "), sql.ErrNoRows)
+	default:
+		return errors.New(c.Error)
+	}
+}
+
+func (c RecordedCall) rows() *staticrows.Rows {
+	rows := &staticrows.Rows{Columns: c.Columns, Values: make([][]any, 0, len(c.Rows))}
+	for _, row := range c.Rows {
+		values := make([]any, len(row))
+		for i, v := range row {
+			values[i] = v.value
+		}
+		rows.Values = append(rows.Values, values)
+	}
+	return rows
+}
+
+func argsJSON(args []recordedValue) string {
+	data, _ := json.Marshal(args)
+	return string(data)
+}
+
+// recordedValue is a driver value in a golden file. Strings, numbers, booleans
+// and NULL are stored as plain JSON, bytes and times as tagged objects.
+type recordedValue struct {
+	value any
+}
+
+func newRecordedValue(v any) recordedValue {
+	if b, ok := v.([]byte); ok && utf8.Valid(b) {
+		return recordedValue{value: string(b)}
+	}
+	if valuer, ok := v.(driver.Valuer); ok {
+		if converted, err := valuer.Value(); err == nil {
+			return newRecordedValue(converted)
+		}
+	}
+	return recordedValue{value: v}
+}
+
+func (v recordedValue) MarshalJSON() ([]byte, error) {
+	switch value := v.value.(type) {
+	case time.Time:
+		return json.Marshal(map[string]string{"time": value.Format(time.RFC3339Nano)})
+	case []byte:
+		return json.Marshal(map[string]string{"bytes": base64.StdEncoding.EncodeToString(value)})
+	default:
+		return json.Marshal(value)
+	}
+}
+
+func (v *recordedValue) UnmarshalJSON(data []byte) error {
+	var tagged map[string]string
+	if json.Unmarshal(data, &tagged) == nil && len(tagged) == 1 {
+		if s, ok := tagged["time"]; ok {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			v.value = t
+			return err
+		}
+		if s, ok := tagged["bytes"]; ok {
+			b, err := base64.StdEncoding.DecodeString(s)
+			v.value = b
+			return err
+		}
+	}
+
+	var number json.Number
+	if json.Unmarshal(data, &number) == nil && number != "" {
+		if i, err := number.Int64(); err == nil {
+			v.value = i
+			return nil
+		}
+		f, err := number.Float64()
+		v.value = f
+		return err
+	}
+
+	return json.Unmarshal(data, &v.value)
+}
+
+func replayRows(ctx context.Context, rows *staticrows.Rows, callback func(rows *sqlx.Rows) error) error {
+	res, err := rows.Query(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+
+	return callback(res)
+}
@@ -0,0 +1,185 @@
+package wsqlxtest_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxfault"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest/wsqlxsqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingT struct {
+	testing.TB
+	errors []string
+}
+
+func (t *recordingT) Errorf(format string, args ...any) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func Test_RecordReplay(t *testing.T) {
+	ctx := context.TODO()
+	golden := filepath.Join(t.TempDir(), "users.golden.json")
+
+	service := func(db wsqlxtest.DB, name string) (names []string, err error) {
+		err = db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			_, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values(name))
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		err = db.QuerySq(ctx, squirrel.Select("name").From("users").OrderBy("id"), func(rows *sqlx.Rows) error {
+			for rows.Next() {
+				var name string
+				if err := rows.Scan(&name); err != nil {
+					return err
+				}
+				names = append(names, name)
+			}
+			return nil
+		})
+		return names, err
+	}
+
+	t.Run("record", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`})
+
+		names, err := service(wsqlxtest.Record(t, golden, fake), "iban")
+		require.NoError(t, err)
+		require.Equal(t, []string{"iban"}, names)
+	})
+
+	t.Run("should replay without database", func(t *testing.T) {
+		names, err := service(wsqlxtest.Replay(t, golden), "iban")
+		require.NoError(t, err)
+		require.Equal(t, []string{"iban"}, names)
+	})
+
+	t.Run("should fail when SQL diverges", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+		_, err := service(wsqlxtest.Replay(rt, golden), "rama")
+		require.ErrorIs(t, err, wsqlxtest.ErrReplayMismatch)
+		require.NotEmpty(t, rt.errors)
+	})
+}
+
+func Test_RecordReplay_QueryRowSqAndPagination(t *testing.T) {
+	ctx := context.TODO()
+	golden := filepath.Join(t.TempDir(), "users.golden.json")
+
+	service := func(db wsqlxtest.DB, name string, page int64) (total int64, err error) {
+		var id int64
+		err = db.QueryRowSq(ctx, squirrel.Select("id").From("users").Where(squirrel.Eq{"name": "iban"}), wsqlx.QueryRowScanTypeDefault, &id)
+		if err != nil {
+			return 0, err
+		}
+
+		countQuery := squirrel.Select("COUNT(*)").From("users").Where(squirrel.Eq{"name": name})
+		query := squirrel.Select("name").From("users").Where(squirrel.Eq{"name": "iban"})
+		output, err := db.QuerySqPagination(ctx, countQuery, query, wsqlx.PaginationInput{Page: page, PageSize: 10}, func(rows *sqlx.Rows) error {
+			return nil
+		})
+		return output.TotalData, err
+	}
+
+	t.Run("record", func(t *testing.T) {
+		fake := wsqlxsqlite.New(t, []string{
+			`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+			`INSERT INTO users (name) VALUES ('iban')`,
+		})
+
+		total, err := service(wsqlxtest.Record(t, golden, fake), "iban", 1)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), total)
+	})
+
+	t.Run("should replay without database", func(t *testing.T) {
+		total, err := service(wsqlxtest.Replay(t, golden), "iban", 1)
+		require.NoError(t, err)
+		require.Equal(t, int64(1), total)
+	})
+
+	t.Run("should fail when the count query args diverge", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+		_, err := service(wsqlxtest.Replay(rt, golden), "rama", 1)
+		require.ErrorIs(t, err, wsqlxtest.ErrReplayMismatch)
+		require.NotEmpty(t, rt.errors)
+	})
+
+	t.Run("should fail when the page diverges", func(t *testing.T) {
+		rt := &recordingT{TB: t}
+		_, err := service(wsqlxtest.Replay(rt, golden), "iban", 2)
+		require.ErrorIs(t, err, wsqlxtest.ErrReplayMismatch)
+		require.NotEmpty(t, rt.errors)
+	})
+}
+
+func Test_RecordReplay_FailedQuery(t *testing.T) {
+	ctx := context.TODO()
+	golden := filepath.Join(t.TempDir(), "missing.golden.json")
+
+	var called bool
+	errCallback := errors.New("callback called")
+	service := func(db wsqlxtest.DB) error {
+		return db.QuerySq(ctx, squirrel.Select("name").From("missing"), func(rows *sqlx.Rows) error {
+			called = true
+			return errCallback
+		})
+	}
+
+	var recorded error
+	t.Run("record", func(t *testing.T) {
+		recorded = service(wsqlxtest.Record(t, golden, wsqlxsqlite.New(t, nil)))
+		require.Error(t, recorded)
+		require.False(t, called)
+	})
+
+	t.Run("should replay the recorded error without calling back", func(t *testing.T) {
+		err := service(wsqlxtest.Replay(t, golden))
+		require.EqualError(t, err, recorded.Error())
+		require.False(t, called)
+	})
+}
+
+func Test_RecordReplay_FailedTx(t *testing.T) {
+	ctx := context.TODO()
+	errInjected := errors.New("injected")
+
+	for _, op := range []wsqlxfault.Operation{wsqlxfault.OperationBegin, wsqlxfault.OperationCommit} {
+		t.Run(op.String(), func(t *testing.T) {
+			golden := filepath.Join(t.TempDir(), "users.golden.json")
+			service := func(db wsqlxtest.DB) error {
+				return db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+					_, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban"))
+					return err
+				})
+			}
+
+			t.Run("record", func(t *testing.T) {
+				fake := wsqlxsqlite.New(t, []string{`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`})
+				db := wsqlxfault.New(fake, wsqlxfault.Config{Faults: []wsqlxfault.Fault{{
+					Operations: []wsqlxfault.Operation{op},
+					Err:        errInjected,
+				}}})
+
+				require.ErrorIs(t, service(wsqlxtest.Record(t, golden, db)), errInjected)
+			})
+
+			t.Run("should replay the recorded error", func(t *testing.T) {
+				err := service(wsqlxtest.Replay(t, golden))
+				require.EqualError(t, err, errInjected.Error())
+			})
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Package wsqlxsqlite provides a fake Rdbms backed by an in-memory SQLite
+// database, so repository tests exercise real SQL without a database server.
+package wsqlxsqlite
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest"
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite"
+)
+
+func init() {
+	sqlx.BindDriver("sqlite", sqlx.QUESTION)
+}
+
+var dbCounter atomic.Int64
+
+// FakeDB is a wsqlx Rdbms and Tx backed by an in-memory SQLite database.
+type FakeDB struct {
+	wsqlxtest.DB
+
+	// SQLX is the underlying database, for setup that can't be expressed
+	// through Rdbms.
+	SQLX *sqlx.DB
+
+	t testing.TB
+}
+
+// New opens an empty in-memory SQLite database private to the test, runs the
+// given schema and fixture statements in order and returns a FakeDB using it.
+// opt configures the Rdbms like NewRdbms does. The database is closed at
+// t.Cleanup.
+func New(t testing.TB, statements []string, opt ...wsqlx.Option) *FakeDB {
+	t.Helper()
+
+	dsn := fmt.Sprintf("file:/wsqlx-%d?vfs=memdb&_pragma=foreign_keys(1)", dbCounter.Add(1))
+	db, err := sqlx.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("wsqlxsqlite: open database: %v", err)
+	}
+
+	// An in-memory database lives as long as one of its connections, pin one
+	// for the whole test.
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("wsqlxsqlite: open connection: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+		_ = db.Close()
+	})
+
+	for _, statement := range statements {
+		if _, err = db.Exec(statement); err != nil {
+			t.Fatalf("wsqlxsqlite: execute %q: %v", statement, err)
+		}
+	}
+
+	return &FakeDB{
+		DB:   wsqlx.NewRdbms(db, opt...),
+		SQLX: db,
+		t:    t,
+	}
+}
+
+// Rows returns the rows of table matching where, all rows when where is nil.
+func (f *FakeDB) Rows(table string, where squirrel.Sqlizer) []map[string]any {
+	f.t.Helper()
+
+	query := squirrel.Select("*").From(table)
+	if where != nil {
+		query = query.Where(where)
+	}
+
+	rows := make([]map[string]any, 0)
+	err := f.QuerySq(context.Background(), query, func(res *sqlx.Rows) error {
+		for res.Next() {
+			row := make(map[string]any)
+			if err := res.MapScan(row); err != nil {
+				return err
+			}
+			rows = append(rows, row)
+		}
+		return res.Err()
+	})
+	if err != nil {
+		f.t.Fatalf("wsqlxsqlite: read rows of %s: %v", table, err)
+	}
+
+	return rows
+}
+
+// Count returns the number of rows of table matching where, all rows when
+// where is nil.
+func (f *FakeDB) Count(table string, where squirrel.Sqlizer) int64 {
+	f.t.Helper()
+
+	query := squirrel.Select("COUNT(*)").From(table)
+	if where != nil {
+		query = query.Where(where)
+	}
+
+	count := int64(0)
+	err := f.QueryRowSq(context.Background(), query, wsqlx.QueryRowScanTypeDefault, &count)
+	if err != nil {
+		f.t.Fatalf("wsqlxsqlite: count rows of %s: %v", table, err)
+	}
+
+	return count
+}
+
+// AssertCount fails the test unless table has want rows matching where.
+func (f *FakeDB) AssertCount(table string, where squirrel.Sqlizer, want int64) {
+	f.t.Helper()
+
+	if got := f.Count(table, where); got != want {
+		f.t.Errorf("wsqlxsqlite: expected %d rows in %s matching %s, got %d", want, table, describe(where), got)
+	}
+}
+
+// AssertExists fails the test unless table has a row matching where.
+func (f *FakeDB) AssertExists(table string, where squirrel.Sqlizer) {
+	f.t.Helper()
+
+	if f.Count(table, where) == 0 {
+		f.t.Errorf("wsqlxsqlite: expected a row in %s matching %s, got none", table, describe(where))
+	}
+}
+
+// AssertNotExists fails the test if table has a row matching where.
+func (f *FakeDB) AssertNotExists(table string, where squirrel.Sqlizer) {
+	f.t.Helper()
+
+	if got := f.Count(table, where); got != 0 {
+		f.t.Errorf("wsqlxsqlite: expected no row in %s matching %s, got %d", table, describe(where), got)
+	}
+}
+
+func describe(where squirrel.Sqlizer) string {
+	if where == nil {
+		return "anything"
+	}
+
+	sql, args, err := where.ToSql()
+	if err != nil {
+		return fmt.Sprintf("<invalid: %v>", err)
+	}
+	return fmt.Sprintf("%s %v", sql, args)
+}
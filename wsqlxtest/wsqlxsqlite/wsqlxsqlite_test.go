@@ -0,0 +1,63 @@
+package wsqlxsqlite_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest/wsqlxsqlite"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FakeDB(t *testing.T) {
+	ctx := context.TODO()
+	db := wsqlxsqlite.New(t, []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+		`INSERT INTO users (id, name) VALUES (1, 'iban')`,
+	})
+
+	t.Run("should run real SQL through Rdbms", func(t *testing.T) {
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			_, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("id", "name").Values(2, "rama"))
+			return err
+		})
+		require.NoError(t, err)
+
+		db.AssertCount("users", nil, 2)
+		db.AssertExists("users", squirrel.Eq{"name": "rama"})
+
+		output, err := db.QuerySqPaginationAuto(ctx, squirrel.Select("id").From("users").OrderBy("id"),
+			wsqlx.PaginationInput{Page: 1, PageSize: 1}, wsqlx.CountStrategyWindow, func(rows *sqlx.Rows) error {
+				return nil
+			})
+		require.NoError(t, err)
+		require.Equal(t, int64(2), output.TotalData)
+	})
+
+	t.Run("should roll back failed transaction", func(t *testing.T) {
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			_, err := tx.ExecSq(ctx, squirrel.Update("users").Set("name", "changed"))
+			require.NoError(t, err)
+			_, err = tx.ExecSq(ctx, squirrel.Insert("users").Columns("id", "name").Values(1, "duplicate"))
+			return err
+		})
+		require.Error(t, err)
+
+		db.AssertNotExists("users", squirrel.Eq{"name": "changed"})
+	})
+}
+
+func Test_New_Options(t *testing.T) {
+	ctx := context.TODO()
+	db := wsqlxsqlite.New(t, []string{
+		`CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL)`,
+	}, wsqlx.WithReadOnly(wsqlx.ReadOnlyConfig{}))
+
+	_, err := db.ExecSq(ctx, squirrel.Insert("users").Columns("id", "name").Values(1, "iban"))
+	require.ErrorIs(t, err, wsqlx.ErrReadOnly)
+
+	db.AssertCount("users", nil, 0)
+}
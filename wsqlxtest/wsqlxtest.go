@@ -0,0 +1,38 @@
+// Package wsqlxtest provides helpers for integration tests running against a
+// real database through wsqlx.
+package wsqlxtest
+
+import (
+	"testing"
+
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/jmoiron/sqlx"
+)
+
+// DB is both the Rdbms for repositories and the Tx for services under test.
+type DB interface {
+	wsqlx.Rdbms
+	wsqlx.Tx
+}
+
+// NewTxDB begins a transaction on db and returns a DB bound to it. The
+// transaction is always rolled back at t.Cleanup, so every test sees a clean
+// database. DoTx and DoTxContext calls on the returned DB run in savepoints, so
+// service-layer code works unchanged, including its rollbacks. opt configures
+// the Rdbms like NewRdbms does.
+func NewTxDB(t testing.TB, db *sqlx.DB, opt ...wsqlx.Option) DB {
+	t.Helper()
+
+	tx, err := db.Beginx()
+	if err != nil {
+		t.Fatalf("wsqlxtest: begin transaction: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := tx.Rollback(); err != nil {
+			t.Errorf("wsqlxtest: rollback transaction: %v", err)
+		}
+	})
+
+	return wsqlx.NewRdbms(db, opt...).BindTx(tx)
+}
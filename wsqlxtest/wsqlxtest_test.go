@@ -0,0 +1,52 @@
+package wsqlxtest_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Masterminds/squirrel"
+	wsqlx "github.com/SyaibanAhmadRamadhan/sqlx-wrapper"
+	"github.com/SyaibanAhmadRamadhan/sqlx-wrapper/wsqlxtest"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_NewTxDB(t *testing.T) {
+	dbMock, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer dbMock.Close()
+
+	ctx := context.TODO()
+	sqlxDB := sqlx.NewDb(dbMock, "sqlmock")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO users (name) VALUES (?)`)).
+		WithArgs("iban").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta(`RELEASE SAVEPOINT wsqlx_sp_1`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`SAVEPOINT wsqlx_sp_2`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ROLLBACK TO SAVEPOINT wsqlx_sp_2`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	t.Run("should run DoTx in savepoints and roll back at cleanup", func(t *testing.T) {
+		db := wsqlxtest.NewTxDB(t, sqlxDB)
+
+		err := db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			_, err := tx.ExecSq(ctx, squirrel.Insert("users").Columns("name").Values("iban"))
+			return err
+		})
+		require.NoError(t, err)
+
+		err = db.DoTx(ctx, &sql.TxOptions{}, func(tx wsqlx.Rdbms) error {
+			return errors.New("rollback")
+		})
+		require.Error(t, err)
+	})
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}